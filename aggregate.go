@@ -0,0 +1,291 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse groupBy, aggregate and having filters.
+
+package filter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Aggregate computes Op over Property for each group, named Alias.
+type Aggregate struct {
+	Alias    string
+	Op       string // count sum avg min max
+	Property string // * for count only
+}
+
+// Aggregates sorted by alias.
+type Aggregates []Aggregate
+
+// grouped report whether f aggregates rows
+func (f *Filter) grouped() bool {
+	return f.GroupBy != nil || f.Aggregates != nil
+}
+
+// BuildGroupBy analyse GroupBy, a property name or an array of them
+func (f *Filter) BuildGroupBy(obj interface{}) *Filter {
+	f.GroupBy = nil
+
+	var groupBy []string
+	var err error
+
+	switch o := obj.(type) {
+	case string:
+		groupBy = []string{o}
+		err = checkField("groupBy", o)
+	case []interface{}:
+		groupBy, err = processFieldsArray("groupBy", o)
+	default:
+		logrus.WithFields(logrus.Fields{
+			"filter": "groupBy",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		err = errors.New(invalidFilter)
+	}
+	if err == nil {
+		err = f.allowFields(groupBy)
+	}
+	if err != nil {
+		f.err = err
+		return f
+	}
+
+	if len(groupBy) != 0 {
+		f.GroupBy = groupBy
+	}
+
+	return f
+}
+
+// BuildAggregate analyse Aggregates, an object mapping each alias to an
+// object of one op and its property, e.g. {"total": {"sum": "price"}}
+func (f *Filter) BuildAggregate(obj interface{}) *Filter {
+	f.Aggregates = nil
+
+	o, ok := obj.(map[string]interface{})
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"filter": "aggregate",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		f.err = errors.New(invalidFilter)
+		return f
+	}
+
+	var aggregates Aggregates
+	for alias, val := range o {
+		aggregate, err := f.processAggregate(alias, val)
+		if err != nil {
+			f.err = err
+			return f
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].Alias < aggregates[j].Alias
+	})
+
+	if len(aggregates) != 0 {
+		f.Aggregates = aggregates
+	}
+
+	return f
+}
+
+func (f *Filter) processAggregate(alias string, val interface{}) (Aggregate, error) {
+	if !columnRegexp.MatchString(alias) {
+		logrus.WithFields(logrus.Fields{
+			"alias": alias,
+		}).Error("The alias isn't an identifier.")
+		return Aggregate{}, errors.Wrap(errors.New(invalidIdentifier), "aggregate."+alias)
+	}
+
+	obj, ok := val.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		logrus.WithFields(logrus.Fields{
+			"alias": alias,
+			"val":   val,
+		}).Error("The val isn't an object.")
+		return Aggregate{}, errors.New(notAnObject)
+	}
+
+	for op, v := range obj {
+		property, ok := v.(string)
+		if !ok {
+			logrus.WithFields(logrus.Fields{
+				"alias": alias,
+				"op":    op,
+				"v":     v,
+			}).Error("the v isn't supported type")
+			return Aggregate{}, errors.New(notSupportType)
+		}
+
+		if property != "*" && !columnRegexp.MatchString(property) {
+			logrus.WithFields(logrus.Fields{
+				"alias":    alias,
+				"property": property,
+			}).Error("The property isn't an identifier.")
+			return Aggregate{}, errors.Wrap(errors.New(invalidIdentifier), "aggregate."+alias)
+		}
+
+		op = strings.ToLower(op)
+		switch {
+		case op == "count" && property == "*":
+		case op == "count", op == "sum", op == "avg", op == "min", op == "max":
+			if err := f.allowFields(Fields{property}); err != nil {
+				return Aggregate{}, err
+			}
+		default:
+			logrus.WithFields(logrus.Fields{
+				"alias":    alias,
+				"op":       op,
+				"property": property,
+			}).Error("The op is invalid keyword.")
+			return Aggregate{}, errors.New(invalidKeyword)
+		}
+
+		return Aggregate{alias, op, property}, nil
+	}
+
+	return Aggregate{}, errors.New(unknownError)
+}
+
+// BuildHaving analyse Having, a where over group properties and aliases
+func (f *Filter) BuildHaving(obj interface{}) *Filter {
+	f.Having = nil
+	f.resetLimits()
+
+	switch w := obj.(type) {
+	case map[string]interface{}:
+		if having, err := f.processObj(nil, "having", w); err == nil {
+			f.Having = having
+		} else {
+			f.err = err
+		}
+	default:
+		logrus.WithFields(logrus.Fields{
+			"filter": "having",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		f.err = errors.New(invalidFilter)
+	}
+
+	return f
+}
+
+// MySQL return the select list of group properties and aggregates
+func (aggregates Aggregates) MySQL() string {
+	var str []string
+
+	for _, a := range aggregates {
+		str = append(str, strings.ToUpper(a.Op)+"("+a.Property+") AS "+a.Alias)
+	}
+
+	return strings.Join(str, ", ")
+}
+
+// expressions map the alias of each aggregate to its expression, name
+// writing the property, for the backends whose HAVING doesn't see the
+// aliases of the select list
+func (aggregates Aggregates) expressions(name func(property string) string) map[string]string {
+	exprs := map[string]string{}
+
+	for _, a := range aggregates {
+		property := a.Property
+		if property != "*" {
+			property = name(property)
+		}
+		exprs[a.Alias] = strings.ToUpper(a.Op) + "(" + property + ")"
+	}
+
+	return exprs
+}
+
+// MongoDBPipeline generates the aggregation pipeline
+func (f *Filter) MongoDBPipeline() (string, error) {
+	var stages []string
+
+	if f.Where != nil {
+		match, err := mongoWhere(f.Where)
+		if err != nil {
+			return "", err
+		}
+		stages = append(stages, `{"$match": `+match+"}")
+	}
+	if f.grouped() {
+		group, err := f.mongoGroup()
+		if err != nil {
+			return "", err
+		}
+		stages = append(stages, group...)
+	} else if f.Fields != nil {
+		stages = append(stages, `{"$project": `+f.Fields.MongoDB()+"}")
+	}
+	if f.Order != nil {
+		stages = append(stages, `{"$sort": `+f.Order.MongoDB()+"}")
+	}
+	if f.Skip != nil {
+		stages = append(stages, `{"$skip": `+strconv.FormatInt(*f.Skip, 10)+"}")
+	}
+	if f.Limit != nil {
+		stages = append(stages, `{"$limit": `+strconv.FormatInt(*f.Limit, 10)+"}")
+	}
+
+	return "[" + strings.Join(stages, ", ") + "]", nil
+}
+
+// mongoGroup return the $group stage, a $project lifting the group
+// properties out of _id, and the having $match
+func (f *Filter) mongoGroup() ([]string, error) {
+	var id, group, project []string
+
+	for _, property := range f.GroupBy {
+		id = append(id, strconv.Quote(property)+": "+strconv.Quote("$"+property))
+		project = append(project, strconv.Quote(property)+": "+strconv.Quote("$_id."+property))
+	}
+	for _, a := range f.Aggregates {
+		var expr string
+		switch {
+		case a.Op == "count" && a.Property == "*":
+			expr = `{"$sum": 1}`
+		case a.Op == "count":
+			// count the rows where the property is present and not null,
+			// as COUNT(property) does, 0, false and "" included
+			p := strconv.Quote("$" + a.Property)
+			expr = `{"$sum": {"$cond": [{"$and": [{"$ne": [{"$type": ` + p + `}, "missing"]}, {"$ne": [` + p + `, null]}]}, 1, 0]}}`
+		default:
+			expr = `{"$` + a.Op + `": ` + strconv.Quote("$"+a.Property) + "}"
+		}
+		group = append(group, strconv.Quote(a.Alias)+": "+expr)
+		project = append(project, strconv.Quote(a.Alias)+": 1")
+	}
+
+	var stages []string
+
+	if id == nil {
+		group = append([]string{`"_id": null`}, group...)
+	} else {
+		group = append([]string{`"_id": {` + strings.Join(id, ", ") + "}"}, group...)
+	}
+	project = append([]string{`"_id": 0`}, project...)
+
+	stages = append(stages, `{"$group": {`+strings.Join(group, ", ")+"}}")
+	stages = append(stages, `{"$project": {`+strings.Join(project, ", ")+"}}")
+	if f.Having != nil {
+		match, err := mongoWhere(f.Having)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, `{"$match": `+match+"}")
+	}
+
+	return stages, nil
+}
@@ -0,0 +1,237 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string for SQL backends that differ
+// only in quoting, placeholders and a few functions.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ansiSyntax supplies what differs between SQL backends to ansi.
+type ansiSyntax interface {
+	// quote an identifier
+	quote(identifier string) string
+
+	// placeholder of the nth bound value
+	placeholder(n int) string
+
+	// bind convert a value to what the backend accepts
+	bind(val interface{}) interface{}
+
+	// contains whether the JSON array holds the value bound to mark
+	contains(array string, mark string) string
+
+	// size of the JSON array
+	size(array string) string
+
+	// elemMatch whether an element of the JSON array, aliased elem
+	// with its JSON in elem.value, satisfies where
+	elemMatch(array string, where string) string
+
+	// near whether point lies within distance meters of lng, lat
+	near(point string, lng string, lat string, distance string) string
+
+	// within whether point lies within the polygon in wkt
+	within(point string, wkt string) string
+
+	// match full-text search of properties for the query bound to mark
+	match(properties []string, mark string, boolean bool) string
+
+	// query translate a search into the backend's full-text syntax
+	query(q string, boolean bool) string
+
+	// orderNull the ORDER BY of rows in no particular order
+	orderNull() string
+}
+
+// ansi renders a filter with syntax
+type ansi struct {
+	ansiSyntax
+	dialect string
+	args    []interface{}
+
+	// the aggregates of the aliases HAVING compares
+	aliases map[string]string
+
+	// the first condition the dialect can't render
+	err error
+}
+
+// mark bind val and return its placeholder
+func (a *ansi) mark(val interface{}) string {
+	a.args = append(a.args, a.bind(val))
+	return a.placeholder(len(a.args))
+}
+
+func (a *ansi) marks(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, a.mark(val))
+	}
+	return strings.Join(str, ", ")
+}
+
+// name quote each segment of a column name such as table.column
+func (a *ansi) name(name string) string {
+	var str []string
+	for _, segment := range strings.Split(name, ".") {
+		str = append(str, a.quote(segment))
+	}
+	return strings.Join(str, ".")
+}
+
+// field return the column, or JSON_VALUE of a path into a JSON column,
+// or the aggregate of an alias
+func (a *ansi) field(p Property) string {
+	if expr, ok := a.aliases[p.Name]; ok {
+		return expr
+	}
+	if !p.JSON {
+		return a.name(p.Name)
+	}
+
+	column, keys := p.split("")
+	if p.Elem {
+		column = a.quote("elem") + "." + a.quote("value")
+	} else {
+		column = a.quote(column)
+	}
+	return "JSON_VALUE(" + column + ", " + postgresValue(jsonPath(keys)) + ")"
+}
+
+// array return the JSON array column or path
+func (a *ansi) array(p Property) string {
+	if !p.JSON {
+		return a.name(p.Name)
+	}
+
+	column, keys := p.split("")
+	if p.Elem {
+		column = a.quote("elem") + "." + a.quote("value")
+	} else {
+		column = a.quote(column)
+	}
+	return "JSON_QUERY(" + column + ", " + postgresValue(jsonPath(keys)) + ")"
+}
+
+func (a *ansi) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, a.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
+}
+
+func (a *ansi) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return a.list(c.Children, " AND ")
+	case OpOr:
+		return a.list(c.Children, " OR ")
+	case OpEq:
+		return a.field(c.Property) + " = " + a.mark(c.Value)
+	case OpNeq:
+		return a.field(c.Property) + " != " + a.mark(c.Value)
+	case OpLt:
+		return a.field(c.Property) + " < " + a.mark(c.Value)
+	case OpLte:
+		return a.field(c.Property) + " <= " + a.mark(c.Value)
+	case OpGt:
+		return a.field(c.Property) + " > " + a.mark(c.Value)
+	case OpGte:
+		return a.field(c.Property) + " >= " + a.mark(c.Value)
+	case OpLike:
+		return a.field(c.Property) + " LIKE " + a.mark(c.Value) + ` ESCAPE '\'`
+	case OpNlike:
+		return a.field(c.Property) + " NOT LIKE " + a.mark(c.Value) + ` ESCAPE '\'`
+	case OpIn:
+		return a.field(c.Property) + " IN (" + a.marks(c.Values) + ")"
+	case OpNin:
+		return a.field(c.Property) + " NOT IN (" + a.marks(c.Values) + ")"
+	case OpAfter:
+		// no row value comparison
+		return a.where(c.expand())
+	case OpContains:
+		return a.contains(a.array(c.Property), a.mark(c.Value))
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			str = append(str, a.contains(a.array(c.Property), a.mark(val)))
+		}
+		return "(" + strings.Join(str, " AND ") + ")"
+	case OpSize:
+		return a.size(a.array(c.Property)) + " = " + a.mark(c.Value)
+	case OpElemMatch:
+		return a.elemMatch(a.array(c.Property), a.where(c.Where))
+	case OpNear:
+		return a.near(a.field(c.Property), a.mark(c.Point.Lng), a.mark(c.Point.Lat), a.mark(c.Distance))
+	case OpWithin:
+		return a.within(a.field(c.Property), a.mark(wkt(c.Polygon)))
+	case OpMatch:
+		var properties []string
+		for _, p := range c.Properties {
+			properties = append(properties, a.field(p))
+		}
+		return a.match(properties, a.mark(a.query(c.Query, c.Boolean)), c.Boolean)
+	default:
+		if a.err == nil {
+			a.err = unsupported(a.dialect, c)
+		}
+		return ""
+	}
+}
+
+// order quote the properties of order
+func (a *ansi) order(order Order) string {
+	str, err := order.orderBy(a.name)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	return str
+}
+
+// filter generates filter syntax, paging with OFFSET ... FETCH which
+// needs an ORDER BY
+func (a *ansi) filter(f *Filter) (string, []interface{}, error) {
+	var sql string
+
+	if f.Where != nil {
+		sql += " WHERE " + a.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		var str []string
+		for _, property := range f.GroupBy {
+			str = append(str, a.name(property))
+		}
+		sql += " GROUP BY " + strings.Join(str, ", ")
+	}
+	if f.Having != nil {
+		// HAVING sees the aggregates, not their aliases
+		a.aliases = f.Aggregates.expressions(a.name)
+		sql += " HAVING " + a.where(f.Having)
+	}
+	if order := a.order(f.Order); order != "" {
+		sql += " ORDER BY " + order
+	} else if f.Limit != nil || f.Skip != nil {
+		sql += " ORDER BY " + a.orderNull()
+	}
+	if f.Limit != nil || f.Skip != nil {
+		var skip int64
+		if f.Skip != nil {
+			skip = *f.Skip
+		}
+		sql += " OFFSET " + strconv.FormatInt(skip, 10) + " ROWS"
+	}
+	if f.Limit != nil {
+		sql += " FETCH NEXT " + strconv.FormatInt(*f.Limit, 10) + " ROWS ONLY"
+	}
+
+	return sql, a.args, a.err
+}
@@ -0,0 +1,150 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse operators on array-valued properties.
+
+package filter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The array contains value.
+type containsCdt struct {
+	Where
+	property Property
+	value    interface{}
+}
+
+func (cdt *containsCdt) Condition() Condition {
+	return Condition{Op: OpContains, Property: cdt.property, Value: cdt.value}
+}
+
+// The array contains every one of values.
+type allCdt struct {
+	Where
+	property Property
+	values   []interface{}
+}
+
+func (cdt *allCdt) Condition() Condition {
+	return Condition{Op: OpAll, Property: cdt.property, Values: cdt.values}
+}
+
+// The array has size elements.
+type sizeCdt struct {
+	Where
+	property Property
+	size     int64
+}
+
+func (cdt *sizeCdt) Condition() Condition {
+	return Condition{Op: OpSize, Property: cdt.property, Value: cdt.size}
+}
+
+// An element of the array matches where, a condition on the element's
+// properties.
+type elemMatchCdt struct {
+	Where
+	property Property
+	where    Where
+}
+
+func (cdt *elemMatchCdt) Condition() Condition {
+	return Condition{Op: OpElemMatch, Property: cdt.property, Where: cdt.where}
+}
+
+func (f *Filter) processContains(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processNeq(parent, path, key, op, val)
+	if err != nil {
+		return nil, err
+	}
+	neq := w.(*neqCdt)
+
+	return &containsCdt{neq.Where, neq.property, neq.value}, nil
+}
+
+func (f *Filter) processAll(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	arr, ok := val.([]interface{})
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+			"val": val,
+		}).Error("The val isn't an array.")
+		return nil, errors.New(notAnArray)
+	}
+	if len(arr) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+			"val": val,
+		}).Error("The val is empty.")
+		return nil, errors.New(emptyArray)
+	}
+
+	if err := f.limitValues(path, arr); err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for i, v := range arr {
+		w, err := f.processNeq(parent, fmt.Sprintf("%s[%d]", path, i), key, op, v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, w.(*neqCdt).value)
+	}
+
+	return &allCdt{parent, f.property(key), values}, nil
+}
+
+func (f *Filter) processSize(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	size, ok := coerceValue(TypeInt, val, time.Time{})
+	if _, str := val.(string); !ok || str || size.(int64) < 0 {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+			"val": val,
+		}).Error("The val isn't a size.")
+		return nil, errors.Wrap(errors.New(invalidValue), path)
+	}
+
+	return &sizeCdt{parent, f.property(key), size.(int64)}, nil
+}
+
+func (f *Filter) processElemMatch(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+			"val": val,
+		}).Error("The val isn't an object.")
+		return nil, errors.New(notAnObject)
+	}
+	if f.elem != "" {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+		}).Error("The elemMatch is nested.")
+		return nil, errors.New(notSupportType)
+	}
+
+	cdt := &elemMatchCdt{parent, f.property(key), nil}
+
+	f.elem = key
+	where, err := f.processObj(cdt, path, obj)
+	f.elem = ""
+	if err != nil {
+		return nil, err
+	}
+	cdt.where = where
+
+	return cdt, nil
+}
@@ -0,0 +1,333 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in BigQuery Standard SQL syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BigQueryParameter is a named query parameter, Type its BigQuery type,
+// e.g. INT64 or ARRAY<STRING>.
+type BigQueryParameter struct {
+	Name  string
+	Type  string
+	Value interface{}
+}
+
+// BigQuery generates filter syntax with the @p0, @p1... parameters it
+// names. Dotted properties access the fields of STRUCT columns, or paths
+// into JSON columns.
+func (f *Filter) BigQuery() (string, []BigQueryParameter, error) {
+	return (&bigquery{schema: f.Schema}).filter(f)
+}
+
+// filter generates filter syntax
+func (bq *bigquery) filter(f *Filter) (string, []BigQueryParameter, error) {
+	var sql string
+
+	if f.Where != nil {
+		sql += " WHERE " + bq.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		var str []string
+		for _, property := range f.GroupBy {
+			str = append(str, bq.name(property))
+		}
+		sql += " GROUP BY " + strings.Join(str, ", ")
+	}
+	if f.Having != nil {
+		sql += " HAVING " + bq.where(f.Having)
+	}
+	if order := bq.order(f.Order); order != "" {
+		sql += " ORDER BY " + order
+	}
+	if f.Limit != nil {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	} else if f.Skip != nil {
+		// OFFSET needs a LIMIT
+		sql += " LIMIT " + strconv.FormatInt(1<<63-1, 10)
+	}
+	if f.Skip != nil {
+		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
+	}
+
+	return sql, bq.params, bq.err
+}
+
+// bigqueryType return the type of the parameter bound to val
+func bigqueryType(val interface{}, t Type) string {
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "INT64"
+	case float32, float64:
+		return "FLOAT64"
+	case bool:
+		return "BOOL"
+	case time.Time:
+		return "TIMESTAMP"
+	}
+
+	if t == TypeDecimal {
+		return "NUMERIC"
+	}
+	return "STRING"
+}
+
+// bigqueryText return val as the text JSON_VALUE extracts
+func bigqueryText(val interface{}) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return jsonValue(val)
+}
+
+// bigquery renders in BigQuery syntax, naming parameters in order
+type bigquery struct {
+	schema Schema
+	params []BigQueryParameter
+
+	// the elements elemMatch unnests are JSON
+	elemJSON bool
+
+	// the first condition bigquery can't render
+	err error
+}
+
+// quote an identifier in backticks
+func (bq *bigquery) quote(identifier string) string {
+	r := strings.NewReplacer("\\", "\\\\", "`", "\\`")
+	return "`" + r.Replace(identifier) + "`"
+}
+
+// name quote each segment of a dotted name, a field of a STRUCT
+func (bq *bigquery) name(name string) string {
+	var str []string
+	for _, segment := range strings.Split(name, ".") {
+		str = append(str, bq.quote(segment))
+	}
+	return strings.Join(str, ".")
+}
+
+// bind val to the next parameter of type typ
+func (bq *bigquery) bind(typ string, val interface{}) string {
+	name := "p" + strconv.Itoa(len(bq.params))
+	bq.params = append(bq.params, BigQueryParameter{name, typ, val})
+	return "@" + name
+}
+
+// typeOf return the type of the parameter bound to val for p
+func (bq *bigquery) typeOf(p Property, val interface{}) string {
+	var t Type
+	if !p.Elem {
+		t = bq.schema[p.Name]
+	}
+	return bigqueryType(val, t)
+}
+
+// elemType return the element type of the array parameter bound to
+// values, FLOAT64 for both integers and floats
+func (bq *bigquery) elemType(p Property, values []interface{}) string {
+	var elem string
+	for _, val := range values {
+		switch t := bq.typeOf(p, val); {
+		case elem == "" || elem == t:
+			elem = t
+		case elem == "INT64" && t == "FLOAT64" || elem == "FLOAT64" && t == "INT64":
+			elem = "FLOAT64"
+		default:
+			elem = "STRING"
+		}
+	}
+
+	if elem == "" {
+		return "STRING"
+	}
+	return elem
+}
+
+// path return the JSON document and the path into it of p, json false
+// when p is a column or the field of a STRUCT
+func (bq *bigquery) path(p Property) (doc string, path string, json bool) {
+	switch {
+	case p.Elem && bq.elemJSON:
+		return bq.quote("elem"), strconv.Quote(jsonPath(strings.Split(p.Name, "."))), true
+	case p.Elem:
+		return bq.name("elem." + p.Name), "", false
+	case !p.JSON:
+		return bq.name(p.Name), "", false
+	}
+
+	column, keys := p.split("")
+	return bq.quote(column), strconv.Quote(jsonPath(keys)), true
+}
+
+// field return the column, or the JSON value converted to typ
+func (bq *bigquery) field(p Property, typ string) string {
+	doc, path, json := bq.path(p)
+	if !json {
+		return doc
+	}
+
+	value := "JSON_VALUE(" + doc + ", " + path + ")"
+	switch typ {
+	case "STRING":
+		return value
+	case "GEOGRAPHY":
+		// points in JSON are WKT
+		return "ST_GEOGFROMTEXT(" + value + ")"
+	default:
+		return "SAFE_CAST(" + value + " AS " + typ + ")"
+	}
+}
+
+// array return the ARRAY column, or JSON_VALUE_ARRAY whose elements are
+// STRING
+func (bq *bigquery) array(p Property) (string, bool) {
+	doc, path, json := bq.path(p)
+	if !json {
+		return doc, false
+	}
+	return "JSON_VALUE_ARRAY(" + doc + ", " + path + ")", true
+}
+
+// element return whether the array holds val
+func (bq *bigquery) element(p Property, val interface{}) string {
+	array, json := bq.array(p)
+	if json {
+		return bq.bind("STRING", bigqueryText(val)) + " IN UNNEST(" + array + ")"
+	}
+	return bq.bind(bq.typeOf(p, val), val) + " IN UNNEST(" + array + ")"
+}
+
+func (bq *bigquery) compare(p Property, op string, val interface{}) string {
+	typ := bq.typeOf(p, val)
+	return bq.field(p, typ) + " " + op + " " + bq.bind(typ, val)
+}
+
+// in return whether p is, or with op NOT IN isn't, one of values bound
+// to an ARRAY parameter
+func (bq *bigquery) in(p Property, op string, values []interface{}) string {
+	elem := bq.elemType(p, values)
+	return bq.field(p, elem) + " " + op + " UNNEST(" + bq.bind("ARRAY<"+elem+">", values) + ")"
+}
+
+func (bq *bigquery) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, bq.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
+}
+
+func (bq *bigquery) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return bq.list(c.Children, " AND ")
+	case OpOr:
+		return bq.list(c.Children, " OR ")
+	case OpEq:
+		return bq.compare(c.Property, "=", c.Value)
+	case OpNeq:
+		return bq.compare(c.Property, "!=", c.Value)
+	case OpLt:
+		return bq.compare(c.Property, "<", c.Value)
+	case OpLte:
+		return bq.compare(c.Property, "<=", c.Value)
+	case OpGt:
+		return bq.compare(c.Property, ">", c.Value)
+	case OpGte:
+		return bq.compare(c.Property, ">=", c.Value)
+	case OpLike:
+		// the pattern as an anchored regex, matching as Match does
+		return "REGEXP_CONTAINS(" + bq.field(c.Property, "STRING") + ", " +
+			bq.bind("STRING", "(?s)"+likeRegexp(c.Value.(string))) + ")"
+	case OpNlike:
+		return "NOT REGEXP_CONTAINS(" + bq.field(c.Property, "STRING") + ", " +
+			bq.bind("STRING", "(?s)"+likeRegexp(c.Value.(string))) + ")"
+	case OpIn:
+		return bq.in(c.Property, "IN", c.Values)
+	case OpNin:
+		return bq.in(c.Property, "NOT IN", c.Values)
+	case OpAfter:
+		// structs only compare for equality
+		return bq.where(c.expand())
+	case OpContains:
+		return bq.element(c.Property, c.Value)
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			str = append(str, bq.element(c.Property, val))
+		}
+		return "(" + strings.Join(str, " AND ") + ")"
+	case OpSize:
+		array, _ := bq.array(c.Property)
+		return "ARRAY_LENGTH(" + array + ") = " + bq.bind(bq.typeOf(c.Property, c.Value), c.Value)
+	case OpElemMatch:
+		var array string
+		doc, path, json := bq.path(c.Property)
+		if json {
+			array = "JSON_QUERY_ARRAY(" + doc + ", " + path + ")"
+		} else {
+			array = doc
+		}
+
+		elemJSON := bq.elemJSON
+		bq.elemJSON = json
+		where := bq.where(c.Where)
+		bq.elemJSON = elemJSON
+
+		return "EXISTS(SELECT 1 FROM UNNEST(" + array + ") AS " + bq.quote("elem") + " WHERE " + where + ")"
+	case OpNear:
+		return "ST_DWITHIN(" + bq.field(c.Property, "GEOGRAPHY") + ", ST_GEOGPOINT(" +
+			bq.bind("FLOAT64", c.Point.Lng) + ", " + bq.bind("FLOAT64", c.Point.Lat) + "), " +
+			bq.bind("FLOAT64", c.Distance) + ")"
+	case OpWithin:
+		return "ST_WITHIN(" + bq.field(c.Property, "GEOGRAPHY") + ", ST_GEOGFROMTEXT(" +
+			bq.bind("STRING", wkt(c.Polygon)) + "))"
+	case OpMatch:
+		return bq.match(c)
+	default:
+		if bq.err == nil {
+			bq.err = unsupported("bigquery", c)
+		}
+		return ""
+	}
+}
+
+// match look the words of the search up with SEARCH, one call a word
+// to and, or and negate them
+func (bq *bigquery) match(c Condition) string {
+	// token return whether a property has the word w, a parameter bound
+	// once for all properties
+	token := func(w string) string {
+		mark := bq.bind("STRING", w)
+
+		var str []string
+		for _, p := range c.Properties {
+			str = append(str, "SEARCH("+bq.field(p, "STRING")+", "+mark+")")
+		}
+		if len(str) == 1 {
+			return str[0]
+		}
+		return "(" + strings.Join(str, " OR ") + ")"
+	}
+
+	return matchTerms(c.Query, c.Boolean, token, "FALSE")
+}
+
+// order quote the properties of order in backticks
+func (bq *bigquery) order(order Order) string {
+	str, err := order.orderBy(bq.name)
+	if err != nil && bq.err == nil {
+		bq.err = err
+	}
+	return str
+}
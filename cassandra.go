@@ -0,0 +1,253 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in Cassandra CQL syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CassandraKey describes the primary key and the secondary indexes of
+// a table.
+type CassandraKey struct {
+	Partition  []string
+	Clustering []string
+	Indexed    []string
+}
+
+// restriction of a column
+const (
+	restrictEq = iota + 1
+	restrictRange
+	restrictIndex
+
+	// the columns after the first of a multi-column slice
+	restrictSlice
+)
+
+// CQL generates filter syntax with ? placeholders and the values bound
+// to them. Where may only and conditions CQL can restrict a column by:
+// or, neq, nlike and nin are errors. filtering reports whether the query
+// restricts columns the key doesn't let cassandra seek to, so that it
+// needs ALLOW FILTERING.
+func (f *Filter) CQL(key CassandraKey) (query Query, filtering bool, err error) {
+	if f.Skip != nil {
+		logrus.WithFields(logrus.Fields{
+			"filter": "skip",
+			"obj":    *f.Skip,
+		}).Error("invalid filter.")
+		return Query{}, false, errors.Wrap(errors.New(notSupportOperator), "skip")
+	}
+	if f.Having != nil {
+		logrus.WithFields(logrus.Fields{
+			"filter": "having",
+		}).Error("invalid filter.")
+		return Query{}, false, errors.Wrap(errors.New(notSupportOperator), "having")
+	}
+
+	cql := &cassandra{key: key, restricted: map[string]int{}}
+
+	if f.Where != nil {
+		var str []string
+		for _, w := range conjuncts(f.Where) {
+			s, err := cql.where(w)
+			if err != nil {
+				return Query{}, false, err
+			}
+			str = append(str, s)
+		}
+		query.SQL += " WHERE " + strings.Join(str, " AND ")
+	}
+	if f.GroupBy != nil {
+		query.SQL += " GROUP BY " + strings.Join(f.GroupBy, ", ")
+	}
+	if f.Order != nil {
+		properties, _, err := f.Order.keys()
+		if err != nil {
+			return Query{}, false, errors.Wrap(err, "order")
+		}
+		for _, property := range properties {
+			if !contains(key.Clustering, property) {
+				logrus.WithFields(logrus.Fields{
+					"order": f.Order,
+				}).Error("The order isn't on clustering columns.")
+				return Query{}, false, errors.Wrap(errors.New(invalidOrder), "order")
+			}
+		}
+		query.SQL += " ORDER BY " + f.Order.MySQL()
+	}
+	if f.Limit != nil {
+		query.SQL += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	}
+
+	query.Args = cql.args
+	return query, cql.filtering(), nil
+}
+
+// conjuncts return the conditions and-ed in w
+func conjuncts(w Where) []Where {
+	c := w.Condition()
+	if c.Op != OpAnd {
+		return []Where{w}
+	}
+
+	var children []Where
+	for _, child := range c.Children {
+		children = append(children, conjuncts(child)...)
+	}
+	return children
+}
+
+// cassandra renders in CQL syntax, recording how each column is
+// restricted
+type cassandra struct {
+	key        CassandraKey
+	restricted map[string]int
+	args       []interface{}
+
+	// a column is restricted twice, but by a range from both sides
+	filter bool
+}
+
+func (cql *cassandra) mark(val interface{}) string {
+	cql.args = append(cql.args, val)
+	return "?"
+}
+
+func (cql *cassandra) marks(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, cql.mark(val))
+	}
+	return strings.Join(str, ", ")
+}
+
+func (cql *cassandra) restrict(column string, restriction int) {
+	prev, ok := cql.restricted[column]
+	if !ok {
+		cql.restricted[column] = restriction
+	} else if prev != restrictRange || restriction != restrictRange {
+		cql.filter = true
+	}
+}
+
+func (cql *cassandra) where(w Where) (string, error) {
+	c := w.Condition()
+	if c.Property.JSON {
+		return "", unsupported("cassandra", c)
+	}
+
+	switch c.Op {
+	case OpEq:
+		cql.restrict(c.Property.Name, restrictEq)
+		return c.Property.Name + " = " + cql.mark(c.Value), nil
+	case OpLt, OpLte, OpGt, OpGte:
+		cql.restrict(c.Property.Name, restrictRange)
+		op := map[Op]string{OpLt: " < ", OpLte: " <= ", OpGt: " > ", OpGte: " >= "}[c.Op]
+		return c.Property.Name + op + cql.mark(c.Value), nil
+	case OpIn:
+		cql.restrict(c.Property.Name, restrictEq)
+		return c.Property.Name + " IN (" + cql.marks(c.Values) + ")", nil
+	case OpLike:
+		// LIKE needs an SASI or SAI index, filtering won't do
+		if !contains(cql.key.Indexed, c.Property.Name) {
+			return "", unsupported("cassandra", c)
+		}
+		cql.restrict(c.Property.Name, restrictIndex)
+		return c.Property.Name + " LIKE " + cql.mark(c.Value), nil
+	case OpContains:
+		cql.restrict(c.Property.Name, restrictIndex)
+		return c.Property.Name + " CONTAINS " + cql.mark(c.Value), nil
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			cql.restrict(c.Property.Name, restrictIndex)
+			str = append(str, c.Property.Name+" CONTAINS "+cql.mark(val))
+		}
+		return strings.Join(str, " AND "), nil
+	case OpAfter:
+		// a multi-column slice must run over leading clustering columns
+		for i, p := range c.Properties {
+			if i >= len(cql.key.Clustering) || cql.key.Clustering[i] != p.Name {
+				return "", unsupported("cassandra", c)
+			}
+			if i == 0 {
+				cql.restrict(p.Name, restrictRange)
+			} else {
+				cql.restrict(p.Name, restrictSlice)
+			}
+		}
+		return c.row(cql.marks(c.Values)), nil
+	default:
+		// or, neq, nlike, nin and the rest have no CQL
+		return "", unsupported("cassandra", c)
+	}
+}
+
+// filtering report whether the restrictions need ALLOW FILTERING: the
+// partition key must be fully restricted by = or IN, the restricted
+// clustering columns must lead the clustering key with at most the last
+// a range, and other columns may only be restricted by one indexed
+// equality.
+func (cql *cassandra) filtering() bool {
+	if len(cql.restricted) == 0 {
+		return false
+	}
+	if cql.filter {
+		return true
+	}
+
+	var partition int
+	for _, column := range cql.key.Partition {
+		switch cql.restricted[column] {
+		case restrictEq:
+			partition++
+		case 0:
+		default:
+			return true
+		}
+	}
+	complete := partition == len(cql.key.Partition) && partition != 0
+	if partition != 0 && !complete {
+		return true
+	}
+
+	var clustering, ranged, gap bool
+	for _, column := range cql.key.Clustering {
+		restriction := cql.restricted[column]
+		switch {
+		case restriction == 0:
+			gap = true
+		case restriction == restrictSlice:
+		case gap || ranged || restriction == restrictIndex:
+			return true
+		case restriction == restrictRange:
+			ranged = true
+			clustering = true
+		default:
+			clustering = true
+		}
+	}
+
+	var indexed int
+	for column, restriction := range cql.restricted {
+		if contains(cql.key.Partition, column) || contains(cql.key.Clustering, column) {
+			continue
+		}
+		if !contains(cql.key.Indexed, column) || restriction == restrictRange {
+			return true
+		}
+		indexed++
+	}
+
+	// one index finds the rows, as the partition key would, clustering
+	// columns only narrow a partition
+	return indexed > 1 || clustering && !complete
+}
@@ -0,0 +1,106 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCQL(t *testing.T) {
+	key := CassandraKey{
+		Partition:  []string{"tenant", "day"},
+		Clustering: []string{"ts", "id"},
+		Indexed:    []string{"email", "name", "tags"},
+	}
+
+	tests := []struct {
+		filter    string
+		sql       string
+		filtering bool
+		err       string
+	}{
+		// the partition key and a range on the first clustering column
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"ts":{"gte":3}}]},"order":"ts desc","limit":20}`,
+			" WHERE tenant = ? AND day = ? AND ts >= ? ORDER BY ts desc LIMIT 20", false, ""},
+		{`{"where":{"and":[{"tenant":{"in":[1,2]}},{"day":2},{"ts":3},{"id":{"lt":4}}]}}`,
+			" WHERE tenant IN (?, ?) AND day = ? AND ts = ? AND id < ?", false, ""},
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"ts":{"gt":1}},{"ts":{"lt":5}}]}}`,
+			" WHERE tenant = ? AND day = ? AND ts > ? AND ts < ?", false, ""},
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"and":[{"ts":3},{"id":4}]}]}}`,
+			" WHERE tenant = ? AND day = ? AND ts = ? AND id = ?", false, ""},
+		{`{}`, "", false, ""},
+
+		// the partition key partly restricted, or by a range
+		{`{"where":{"tenant":1}}`, " WHERE tenant = ?", true, ""},
+		{`{"where":{"and":[{"tenant":1},{"day":{"gt":2}}]}}`, " WHERE tenant = ? AND day > ?", true, ""},
+
+		// clustering columns skipped, or restricted after a range
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"id":4}]}}`, " WHERE tenant = ? AND day = ? AND id = ?", true, ""},
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"ts":{"gt":3}},{"id":4}]}}`,
+			" WHERE tenant = ? AND day = ? AND ts > ? AND id = ?", true, ""},
+		{`{"where":{"ts":3}}`, " WHERE ts = ?", true, ""},
+
+		// a column restricted twice
+		{`{"where":{"and":[{"tenant":1},{"tenant":2},{"day":2}]}}`, " WHERE tenant = ? AND tenant = ? AND day = ?", true, ""},
+
+		// secondary indexes
+		{`{"where":{"email":"a@b"}}`, " WHERE email = ?", false, ""},
+		{`{"where":{"and":[{"tenant":1},{"day":2},{"email":"a@b"}]}}`, " WHERE tenant = ? AND day = ? AND email = ?", false, ""},
+		{`{"where":{"and":[{"email":"a@b"},{"ts":3}]}}`, " WHERE email = ? AND ts = ?", true, ""},
+		{`{"where":{"and":[{"email":"a@b"},{"name":"x"}]}}`, " WHERE email = ? AND name = ?", true, ""},
+		{`{"where":{"email":{"gt":"a"}}}`, " WHERE email > ?", true, ""},
+		{`{"where":{"name":{"like":"as%"}}}`, " WHERE name LIKE ?", false, ""},
+		{`{"where":{"tags":{"contains":"go"}}}`, " WHERE tags CONTAINS ?", false, ""},
+		{`{"where":{"tags":{"all":["go","sql"]}}}`, " WHERE tags CONTAINS ? AND tags CONTAINS ?", true, ""},
+		{`{"where":{"age":3}}`, " WHERE age = ?", true, ""},
+
+		// what CQL cannot restrict
+		{`{"where":{"or":[{"tenant":1},{"tenant":2}]}}`, "", false, "or: " + notSupportOperator},
+		{`{"where":{"tenant":{"neq":1}}}`, "", false, "tenant.neq: " + notSupportOperator},
+		{`{"where":{"age":{"like":"1%"}}}`, "", false, "age.like: " + notSupportOperator},
+		{`{"where":{"tenant":1},"skip":5}`, "", false, "skip: " + notSupportOperator},
+		{`{"where":{"tenant":1},"order":"age"}`, "", false, "order: " + invalidOrder},
+	}
+
+	for _, tt := range tests {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.filter), &obj); err != nil {
+			t.Fatal(err)
+		}
+
+		f := New().Build(obj)
+		if err := f.Error(); err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+
+		q, filtering, err := f.CQL(key)
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got %q %v, want %s", tt.filter, q.SQL, err, tt.err)
+			}
+		case err != nil || q.SQL != tt.sql || filtering != tt.filtering:
+			t.Errorf("%s: got %q %v %v, want %q %v", tt.filter, q.SQL, filtering, err, tt.sql, tt.filtering)
+		}
+	}
+}
+
+func TestCQLAfter(t *testing.T) {
+	key := CassandraKey{Partition: []string{"tenant"}, Clustering: []string{"ts", "id"}}
+
+	f := New().Build(map[string]interface{}{"where": map[string]interface{}{"tenant": 1.0}, "order": []interface{}{"ts", "id"}})
+	f.After(3, 4)
+	q, filtering, err := f.CQL(key)
+	if err != nil || q.SQL != " WHERE tenant = ? AND (ts, id) > (?, ?) ORDER BY ts, id" || filtering {
+		t.Errorf("got %q %v %v", q.SQL, filtering, err)
+	}
+
+	f = New().Build(map[string]interface{}{"where": map[string]interface{}{"tenant": 1.0}, "order": []interface{}{"id"}})
+	f.After(4)
+	if _, filtering, err := f.CQL(key); err != nil || !filtering {
+		t.Errorf("a seek on id alone got %v %v, want filtering", filtering, err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in ClickHouse syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClickHouse generates filter syntax with {pN:Type} parameters and the
+// values bound to them, args[N-1] being the value of parameter pN
+func (f *Filter) ClickHouse() (string, []interface{}, error) {
+	return (&clickhouse{schema: f.Schema}).filter(f)
+}
+
+// filter generates filter syntax
+func (ch *clickhouse) filter(f *Filter) (string, []interface{}, error) {
+	var sql string
+
+	if f.Where != nil {
+		sql += " WHERE " + ch.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		sql += " GROUP BY " + strings.Join(f.GroupBy, ", ")
+	}
+	if f.Having != nil {
+		sql += " HAVING " + ch.where(f.Having)
+	}
+	if f.Order != nil {
+		order, err := f.Order.orderBy(asIs)
+		if err != nil {
+			return "", nil, err
+		}
+		sql += " ORDER BY " + order
+	}
+	if f.Limit != nil {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+		if f.Skip != nil {
+			sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
+		}
+	} else if f.Skip != nil {
+		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10) + " ROWS"
+	}
+
+	return sql, ch.args, ch.err
+}
+
+// clickhouse renders in ClickHouse syntax, binding values to typed
+// parameters named in order
+type clickhouse struct {
+	schema Schema
+	args   []interface{}
+
+	// the first condition clickhouse can't render
+	err error
+}
+
+// clickhouseType return the type of the parameter bound to val
+func clickhouseType(val interface{}, t Type) string {
+	switch val.(type) {
+	case int, int8, int16, int32, int64:
+		return "Int64"
+	case uint, uint8, uint16, uint32, uint64:
+		return "UInt64"
+	case float32, float64:
+		return "Float64"
+	case bool:
+		return "Bool"
+	case time.Time:
+		return "DateTime64(6)"
+	}
+
+	if t == TypeUUID {
+		return "UUID"
+	}
+	return "String"
+}
+
+// mark bind val to the next parameter, typed after val or the type the
+// schema declares for p
+func (ch *clickhouse) mark(p Property, val interface{}) string {
+	ch.args = append(ch.args, val)
+
+	var t Type
+	if !p.Elem {
+		t = ch.schema[p.Name]
+	}
+	return "{p" + strconv.Itoa(len(ch.args)) + ":" + clickhouseType(val, t) + "}"
+}
+
+func (ch *clickhouse) marks(p Property, values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, ch.mark(p, val))
+	}
+	return strings.Join(str, ", ")
+}
+
+// field return the column, or the subcolumn of a path into a JSON column;
+// the array element of elemMatch is elem
+func (ch *clickhouse) field(p Property) string {
+	if p.Elem {
+		return "elem." + p.Name
+	}
+	return p.Name
+}
+
+func (ch *clickhouse) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, ch.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
+}
+
+func (ch *clickhouse) compare(p Property, op string, val interface{}) string {
+	return ch.field(p) + " " + op + " " + ch.mark(p, val)
+}
+
+func (ch *clickhouse) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return ch.list(c.Children, " AND ")
+	case OpOr:
+		return ch.list(c.Children, " OR ")
+	case OpEq:
+		return ch.compare(c.Property, "=", c.Value)
+	case OpNeq:
+		return ch.compare(c.Property, "!=", c.Value)
+	case OpLt:
+		return ch.compare(c.Property, "<", c.Value)
+	case OpLte:
+		return ch.compare(c.Property, "<=", c.Value)
+	case OpGt:
+		return ch.compare(c.Property, ">", c.Value)
+	case OpGte:
+		return ch.compare(c.Property, ">=", c.Value)
+	case OpLike:
+		// LIKE is case sensitive in clickhouse, unlike in MySQL
+		return ch.compare(c.Property, "ILIKE", c.Value)
+	case OpNlike:
+		return ch.compare(c.Property, "NOT ILIKE", c.Value)
+	case OpIn:
+		return ch.field(c.Property) + " IN (" + ch.marks(c.Property, c.Values) + ")"
+	case OpNin:
+		return ch.field(c.Property) + " NOT IN (" + ch.marks(c.Property, c.Values) + ")"
+	case OpAfter:
+		// tuples compare in order
+		var values []string
+		for i, val := range c.Values {
+			values = append(values, ch.mark(c.Properties[i], val))
+		}
+		return c.row(strings.Join(values, ", "))
+	case OpContains:
+		return "has(" + ch.field(c.Property) + ", " + ch.mark(c.Property, c.Value) + ")"
+	case OpAll:
+		return "hasAll(" + ch.field(c.Property) + ", [" + ch.marks(c.Property, c.Values) + "])"
+	case OpSize:
+		return "length(" + ch.field(c.Property) + ") = " + ch.mark(c.Property, c.Value)
+	case OpElemMatch:
+		return "arrayExists(elem -> " + ch.where(c.Where) + ", " + ch.field(c.Property) + ")"
+	case OpNear:
+		// points are Point, a tuple (lng, lat)
+		p := ch.field(c.Property)
+		return "greatCircleDistance(" + p + ".1, " + p + ".2, " + ch.mark(c.Property, c.Point.Lng) + ", " +
+			ch.mark(c.Property, c.Point.Lat) + ") <= " + ch.mark(c.Property, c.Distance)
+	case OpWithin:
+		var ring []string
+		for _, point := range c.Polygon {
+			ring = append(ring, "("+ch.mark(c.Property, point.Lng)+", "+ch.mark(c.Property, point.Lat)+")")
+		}
+		return "pointInPolygon(" + ch.field(c.Property) + ", [" + strings.Join(ring, ", ") + "])"
+	case OpMatch:
+		return ch.match(c)
+	default:
+		if ch.err == nil {
+			ch.err = unsupported("clickhouse", c)
+		}
+		return ""
+	}
+}
+
+// match look the words of the search up as tokens of the properties,
+// clickhouse has no full-text index to search
+func (ch *clickhouse) match(c Condition) string {
+	// token return whether a property has the token w, a parameter
+	// bound once for all properties
+	token := func(w string) string {
+		mark := ch.mark(Property{}, w)
+
+		var str []string
+		for _, p := range c.Properties {
+			str = append(str, "hasTokenCaseInsensitive("+ch.field(p)+", "+mark+")")
+		}
+		if len(str) == 1 {
+			return str[0]
+		}
+		return "(" + strings.Join(str, " OR ") + ")"
+	}
+
+	return matchTerms(c.Query, c.Boolean, token, "0")
+}
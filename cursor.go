@@ -0,0 +1,315 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Keyset pagination: seek past the last row of a page instead of
+// skipping rows with OFFSET.
+
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	invalidOrder  = "invalid order"
+	invalidCursor = "invalid cursor"
+)
+
+// cursor is the content of an encoded cursor token.
+type cursor struct {
+	Order  Order         `json:"o"`
+	Values []interface{} `json:"v"`
+}
+
+// seekCdt compares a row of properties sharing one sort direction.
+type seekCdt struct {
+	Where
+	properties []string
+	desc       bool
+	values     []interface{}
+}
+
+func (cdt *seekCdt) Condition() Condition {
+	var properties []Property
+	for _, property := range cdt.properties {
+		properties = append(properties, Property{Name: property})
+	}
+
+	return Condition{Op: OpAfter, Properties: properties, Desc: cdt.desc, Values: cdt.values}
+}
+
+// keys split order into properties and their descending flags
+func (order Order) keys() ([]string, []bool, error) {
+	var properties []string
+	var descs []bool
+
+	for _, o := range order {
+		fields := strings.Fields(o)
+		switch {
+		case len(fields) == 1:
+			properties = append(properties, fields[0])
+			descs = append(descs, false)
+		case len(fields) == 2 && strings.EqualFold(fields[1], "ASC"):
+			properties = append(properties, fields[0])
+			descs = append(descs, false)
+		case len(fields) == 2 && strings.EqualFold(fields[1], "DESC"):
+			properties = append(properties, fields[0])
+			descs = append(descs, true)
+		default:
+			logrus.WithFields(logrus.Fields{
+				"order": o,
+			}).Error("The order isn't a property and a direction.")
+			return nil, nil, errors.New(invalidOrder)
+		}
+	}
+
+	return properties, descs, nil
+}
+
+// orderBy render the ORDER BY list of order, name writing each
+// property. An order that isn't property names and directions is the
+// error.
+func (order Order) orderBy(name func(property string) string) (string, error) {
+	properties, descs, err := order.keys()
+	if err != nil {
+		return "", errors.Wrap(err, "order")
+	}
+
+	var str []string
+	for i, property := range properties {
+		if err := checkField("order", property); err != nil {
+			return "", err
+		}
+		if descs[i] {
+			str = append(str, name(property)+" DESC")
+		} else {
+			str = append(str, name(property))
+		}
+	}
+	return strings.Join(str, ", "), nil
+}
+
+// asIs write a property unquoted
+func asIs(property string) string {
+	return property
+}
+
+// After restrict f to the rows following the row whose sort values are
+// values, in f's order. Skip is dropped since the seek replaces it, as
+// it replaces the seek of an earlier After.
+func (f *Filter) After(values ...interface{}) *Filter {
+	properties, descs, err := f.Order.keys()
+	if err != nil {
+		f.err = err
+		return f
+	}
+	if len(properties) == 0 || len(properties) != len(values) {
+		logrus.WithFields(logrus.Fields{
+			"order":  f.Order,
+			"values": values,
+		}).Error("The values don't match the order.")
+		f.err = errors.New(invalidCursor)
+		return f
+	}
+
+	coerced := make([]interface{}, len(values))
+	for i, v := range values {
+		if coerced[i], err = f.coerce(fmt.Sprintf("cursor[%d]", i), properties[i], v); err != nil {
+			f.err = err
+			return f
+		}
+	}
+
+	f.Where = f.unseeked()
+	f.Skip = nil
+	f.seek = seek(properties, descs, coerced)
+	return f.And(f.seek)
+}
+
+// unseeked return Where without the cursor seek
+func (f *Filter) unseeked() Where {
+	and, ok := f.Where.(*andCdt)
+	if !ok || f.seek == nil {
+		return f.Where
+	}
+
+	var children []Where
+	for _, child := range and.children {
+		if child != f.seek {
+			children = append(children, child)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	default:
+		return &andCdt{nil, children}
+	}
+}
+
+// seek build the predicate selecting rows after values. A uniform
+// direction is a single row comparison, mixed directions expand into
+// (a > ?) OR (a = ? AND b < ?) ...
+func seek(properties []string, descs []bool, values []interface{}) Where {
+	uniform := true
+	for _, desc := range descs {
+		uniform = uniform && desc == descs[0]
+	}
+
+	if uniform {
+		if len(properties) == 1 {
+			return after(nil, properties[0], descs[0], values[0])
+		}
+		return &seekCdt{nil, properties, descs[0], values}
+	}
+
+	return expand(properties, descs, values)
+}
+
+// expand build (a > ?) OR (a = ? AND b < ?) ...
+func expand(properties []string, descs []bool, values []interface{}) *orCdt {
+	or := &orCdt{nil, []Where{}}
+	or.Child(after(or, properties[0], descs[0], values[0]))
+	for i := 1; i < len(properties); i++ {
+		and := &andCdt{or, []Where{}}
+		for j := 0; j < i; j++ {
+			and.Child(&eqCdt{and, Property{Name: properties[j]}, values[j]})
+		}
+		and.Child(after(and, properties[i], descs[i], values[i]))
+		or.Child(and)
+	}
+
+	return or
+}
+
+// expand the after condition c for backends without row comparison,
+// (a, b) > (x, y) becomes a > x OR (a = x AND b > y)
+func (c Condition) expand() Where {
+	properties := make([]string, len(c.Properties))
+	descs := make([]bool, len(c.Properties))
+	for i, p := range c.Properties {
+		properties[i] = p.Name
+		descs[i] = c.Desc
+	}
+
+	return expand(properties, descs, c.Values)
+}
+
+// row return (a, b) > (values), or < when descending
+func (c Condition) row(values string) string {
+	var properties []string
+	for _, p := range c.Properties {
+		properties = append(properties, p.Name)
+	}
+
+	op := " > ("
+	if c.Desc {
+		op = " < ("
+	}
+
+	return "(" + strings.Join(properties, ", ") + ")" + op + values + ")"
+}
+
+func after(parent Where, property string, desc bool, value interface{}) Where {
+	if desc {
+		return &ltCdt{parent, Property{Name: property}, value}
+	}
+	return &gtCdt{parent, Property{Name: property}, value}
+}
+
+// cursorTime is a time sort value in a token, which JSON would decode
+// as a string.
+type cursorTime struct {
+	Time time.Time `json:"t"`
+}
+
+// Cursor encode the sort values of the last row of a page into an opaque
+// token, which BuildAfter turns back into the seek for the next page.
+func (f *Filter) Cursor(values ...interface{}) (string, error) {
+	encoded := make([]interface{}, len(values))
+	for i, v := range values {
+		if t, ok := v.(time.Time); ok {
+			encoded[i] = cursorTime{t}
+		} else {
+			encoded[i] = v
+		}
+	}
+
+	b, err := json.Marshal(cursor{f.Order, encoded})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"values": values,
+		}).Error("The values cannot be encoded.")
+		return "", errors.Wrap(err, invalidCursor)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// BuildAfter analyse After, a token issued by Cursor for the same order
+func (f *Filter) BuildAfter(obj interface{}) *Filter {
+	token, ok := obj.(string)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"filter": "after",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		f.err = errors.New(invalidFilter)
+		return f
+	}
+
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		// numbers as json.Number, an int64 key beyond 2^53 would lose
+		// precision as float64
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err = d.Decode(&c)
+	}
+	for i := 0; err == nil && i < len(c.Values); i++ {
+		c.Values[i], err = cursorValue(c.Values[i])
+	}
+	if err != nil || strings.Join(c.Order, ",") != strings.Join(f.Order, ",") {
+		logrus.WithFields(logrus.Fields{
+			"filter": "after",
+			"obj":    obj,
+		}).Error("The cursor doesn't belong to the order.")
+		f.err = errors.New(invalidCursor)
+		return f
+	}
+
+	return f.After(c.Values...)
+}
+
+// cursorValue return the sort value v decoded from a token: integers as
+// int64, other numbers as float64, times as time.Time
+func cursorValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n, nil
+		}
+		return val.Float64()
+	case map[string]interface{}:
+		s, ok := val["t"].(string)
+		if !ok || len(val) != 1 {
+			return nil, errors.New(invalidCursor)
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAfterReplacesSeek(t *testing.T) {
+	f := New().Build(map[string]interface{}{"where": map[string]interface{}{"b": 1.0}, "order": "a"})
+	f.After(1).After(2)
+
+	sql, args, err := f.MySQLArgs()
+	if err != nil || sql != " WHERE (b = ? AND a > ?) ORDER BY a" || !equalArgs(args, []interface{}{1.0, 2}) {
+		t.Errorf("got %q %v %v", sql, args, err)
+	}
+	sql, args, err = f.MySQLCount()
+	if err != nil || sql != " WHERE b = ?" || !equalArgs(args, []interface{}{1.0}) {
+		t.Errorf("count got %q %v %v", sql, args, err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2017, 3, 1, 10, 30, 0, 123456789, time.FixedZone("", 3600))
+	values := []interface{}{int64(1) << 60, 1.5, "a)b", at}
+	order := []interface{}{"n", "x", "s", "t"}
+
+	token, err := New().Build(map[string]interface{}{"order": order}).Cursor(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := New().Build(map[string]interface{}{"order": order, "skip": 10, "after": token})
+	sql, args, err := f.MySQLArgs()
+	if err != nil || sql != " WHERE ((n, x, s, t) > (?, ?, ?, ?)) ORDER BY n, x, s, t" || !equalArgs(args, values) {
+		t.Errorf("got %q %v %v", sql, args, err)
+	}
+	if f.Skip != nil {
+		t.Errorf("skip %d kept with a cursor", *f.Skip)
+	}
+
+	// a token is bound to the order it was issued for
+	for _, after := range []interface{}{token[1:], 1, "e30"} {
+		f := New().Build(map[string]interface{}{"order": order, "after": after})
+		if f.Error() == nil {
+			t.Errorf("%v: no error", after)
+		}
+	}
+	f = New().Build(map[string]interface{}{"order": []interface{}{"n", "x", "s", "t DESC"}, "after": token})
+	if err := f.Error(); err == nil || err.Error() != invalidCursor {
+		t.Errorf("other order got %v, want %s", err, invalidCursor)
+	}
+}
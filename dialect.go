@@ -0,0 +1,183 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Render tree structure for backends registered by name.
+
+package filter
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	unknownDialect     = "unknown dialect"
+	notSupportOperator = "not support operator"
+)
+
+// unsupported log and return the error of a dialect lacking c.Op
+func unsupported(dialect string, c Condition) error {
+	name := c.Property.Name
+	if name == "" && len(c.Properties) != 0 {
+		name = c.Properties[0].Name
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"dialect":  dialect,
+		"op":       c.Op,
+		"property": name,
+	}).Error("The op isn't supported by the dialect.")
+	if name == "" {
+		return errors.Wrap(errors.New(notSupportOperator), string(c.Op))
+	}
+	return errors.Wrap(errors.New(notSupportOperator), name+"."+string(c.Op))
+}
+
+// Op is the operator of a condition.
+type Op string
+
+const (
+	OpAnd       Op = "and"
+	OpOr        Op = "or"
+	OpEq        Op = "eq"
+	OpNeq       Op = "neq"
+	OpLt        Op = "lt"
+	OpLte       Op = "lte"
+	OpGt        Op = "gt"
+	OpGte       Op = "gte"
+	OpLike      Op = "like"
+	OpNlike     Op = "nlike"
+	OpIn        Op = "in"
+	OpNin       Op = "nin"
+	OpAfter     Op = "after"
+	OpContains  Op = "contains"
+	OpAll       Op = "all"
+	OpSize      Op = "size"
+	OpElemMatch Op = "elemMatch"
+	OpNear      Op = "near"
+	OpWithin    Op = "within"
+	OpMatch     Op = "match"
+)
+
+// Condition is a node of the where tree as a Dialect sees it. Which
+// fields are set depends on Op.
+type Condition struct {
+	Op Op
+
+	// The property compared; those of after and match.
+	Property   Property
+	Properties []Property
+
+	// The value of eq to gte, like, nlike and contains, the size of size.
+	Value interface{}
+
+	// The values of in, nin and all, one per property of after.
+	Values []interface{}
+
+	// The conditions of and and or.
+	Children []Where
+
+	// The condition elements of elemMatch satisfy.
+	Where Where
+
+	// Whether after seeks in descending order.
+	Desc bool
+
+	// The center and the distance in meters of near.
+	Point    Point
+	Distance float64
+
+	// The closed ring of within.
+	Polygon []Point
+
+	// The search of match, in boolean mode when Boolean.
+	Query   string
+	Boolean bool
+}
+
+// A Dialect renders a filter for a backend, returning the query and the
+// values bound to its placeholders.
+type Dialect interface {
+	Render(f *Filter) (string, []interface{}, error)
+}
+
+// DialectFunc is a function used as a Dialect.
+type DialectFunc func(f *Filter) (string, []interface{}, error)
+
+// Render calls fn(f)
+func (fn DialectFunc) Render(f *Filter) (string, []interface{}, error) {
+	return fn(f)
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		"mysql":     DialectFunc((*Filter).MySQLArgs),
+		"postgres":  DialectFunc((*Filter).Postgres),
+		"sqlite":    DialectFunc((*Filter).SQLite),
+		"sqlserver": DialectFunc((*Filter).SQLServer),
+		"oracle":    DialectFunc((*Filter).Oracle),
+		"mongodb": DialectFunc(func(f *Filter) (string, []interface{}, error) {
+			query, err := f.MongoDB()
+			return query, nil, err
+		}),
+		"elasticsearch": DialectFunc(func(f *Filter) (string, []interface{}, error) {
+			body, err := f.Elasticsearch()
+			return body, nil, err
+		}),
+		"clickhouse": DialectFunc((*Filter).ClickHouse),
+		"bigquery": DialectFunc(func(f *Filter) (string, []interface{}, error) {
+			sql, params, err := f.BigQuery()
+
+			var args []interface{}
+			for _, param := range params {
+				args = append(args, param)
+			}
+			return sql, args, err
+		}),
+		"ldap": DialectFunc(func(f *Filter) (string, []interface{}, error) {
+			query, err := f.LDAP()
+			return query, nil, err
+		}),
+		"redisearch": DialectFunc(func(f *Filter) (string, []interface{}, error) {
+			query, args, err := f.RediSearch()
+			if err != nil {
+				return "", nil, err
+			}
+
+			var values []interface{}
+			for _, arg := range args {
+				values = append(values, arg)
+			}
+			return query, values, nil
+		}),
+	}
+)
+
+// Register make d available to Render under name, replacing any dialect
+// registered under it before.
+func Register(name string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+
+	dialects[name] = d
+}
+
+// Render renders f with the dialect registered under name
+func (f *Filter) Render(name string) (string, []interface{}, error) {
+	dialectsMu.RLock()
+	d, ok := dialects[name]
+	dialectsMu.RUnlock()
+
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"dialect": name,
+		}).Error("The dialect isn't registered.")
+		return "", nil, errors.New(unknownDialect)
+	}
+
+	return d.Render(f)
+}
@@ -0,0 +1,203 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		filter       string
+		mysql        string
+		mysqlArgs    []interface{}
+		postgres     string
+		postgresArgs []interface{}
+		mongodb      string
+	}{
+		{
+			`{"where":{"a":1}}`,
+			" WHERE a = ?", []interface{}{float64(1)},
+			" WHERE a = $1", []interface{}{float64(1)},
+			`{"a": 1}`,
+		},
+		{
+			`{"where":{"and":[{"name":"it's \\ x"},{"n":{"neq":2}}]}}`,
+			" WHERE (name = ? AND n != ?)", []interface{}{"it's \\ x", float64(2)},
+			" WHERE (name = $1 AND n != $2)", []interface{}{"it's \\ x", float64(2)},
+			`{"$and": [{"name": "it's \\ x"}, {"n": {"$ne": 2}}]}`,
+		},
+		{
+			`{"where":{"and":[{"a":{"lt":1}},{"b":{"lte":2}},{"or":[{"c":{"gt":3}},{"d":{"gte":4}}]}]}}`,
+			" WHERE (a < ? AND b <= ? AND (c > ? OR d >= ?))", []interface{}{float64(1), float64(2), float64(3), float64(4)},
+			" WHERE (a < $1 AND b <= $2 AND (c > $3 OR d >= $4))", []interface{}{float64(1), float64(2), float64(3), float64(4)},
+			`{"$and": [{"a": {"$lt": 1}}, {"b": {"$lte": 2}}, {"$or": [{"c": {"$gt": 3}}, {"d": {"$gte": 4}}]}]}`,
+		},
+		{
+			`{"where":{"and":[{"name":{"like":"a%_"}},{"title":{"nlike":"%b"}}]}}`,
+			" WHERE (name LIKE ? AND title NOT LIKE ?)", []interface{}{"a%_", "%b"},
+			" WHERE (name LIKE $1 AND title NOT LIKE $2)", []interface{}{"a%_", "%b"},
+			`{"$and": [{"name": {"$regex": "^a.*.$"}}, {"title": {"$not": {"$regex": "^.*b$"}}}]}`,
+		},
+		{
+			`{"where":{"or":[{"id":{"in":[1,2,3]}},{"tag":{"nin":["x","y"]}}]}}`,
+			" WHERE (id IN (?, ?, ?) OR tag NOT IN (?, ?))", []interface{}{float64(1), float64(2), float64(3), "x", "y"},
+			" WHERE (id IN ($1, $2, $3) OR tag NOT IN ($4, $5))", []interface{}{float64(1), float64(2), float64(3), "x", "y"},
+			`{"$or": [{"id": {"$in": [1, 2, 3]}}, {"tag": {"$nin": ["x", "y"]}}]}`,
+		},
+		{
+			`{"where":{"and":[{"born":{"gt":"2020-01-02"}},{"ok":true}]}}`,
+			" WHERE (born > ? AND ok = ?)", []interface{}{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), true},
+			" WHERE (born > $1 AND ok = $2)", []interface{}{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), true},
+			`{"$and": [{"born": {"$gt": {"$date": "2020-01-02T00:00:00Z"}}}, {"ok": true}]}`,
+		},
+		{
+			`{"where":{"or":[{"doc.city":"paris"},{"doc.zip":{"gt":5}}]}}`,
+			" WHERE (doc->>'$.city' = ? OR doc->>'$.zip' > ?)", []interface{}{"paris", float64(5)},
+			" WHERE (doc->>'city' = $1 OR (doc->>'zip')::numeric > $2)", []interface{}{"paris", float64(5)},
+			`{"$or": [{"doc.city": "paris"}, {"doc.zip": {"$gt": 5}}]}`,
+		},
+		{
+			`{"where":{"tags":{"contains":"go"}}}`,
+			" WHERE JSON_CONTAINS(tags, ?)", []interface{}{"\"go\""},
+			" WHERE $1 = ANY(tags)", []interface{}{"go"},
+			`{"tags": "go"}`,
+		},
+		{
+			`{"where":{"tags":{"all":["go","sql"]}}}`,
+			" WHERE JSON_CONTAINS(tags, ?)", []interface{}{"[\"go\",\"sql\"]"},
+			" WHERE tags @> ARRAY[$1, $2]", []interface{}{"go", "sql"},
+			`{"tags": {"$all": ["go", "sql"]}}`,
+		},
+		{
+			`{"where":{"tags":{"size":2}}}`,
+			" WHERE JSON_LENGTH(tags) = ?", []interface{}{int64(2)},
+			" WHERE cardinality(tags) = $1", []interface{}{int64(2)},
+			`{"tags": {"$size": 2}}`,
+		},
+		{
+			`{"where":{"items":{"elemMatch":{"and":[{"price":{"gt":2}},{"name":{"like":"x%"}}]}}}}`,
+			" WHERE EXISTS (SELECT 1 FROM JSON_TABLE(items, '$[*]' COLUMNS (value JSON PATH '$')) AS elem WHERE (elem.value->>'$.price' > ? AND elem.value->>'$.name' LIKE ?))", []interface{}{int64(2), "x%"},
+			" WHERE EXISTS (SELECT 1 FROM jsonb_array_elements(items) AS elem WHERE ((elem->>'price')::numeric > $1 AND elem->>'name' LIKE $2))", []interface{}{int64(2), "x%"},
+			`{"items": {"$elemMatch": {"$and": [{"price": {"$gt": 2}}, {"name": {"$regex": "^x.*$"}}]}}}`,
+		},
+		{
+			`{"where":{"loc":{"near":"1,2","maxDistance":3,"unit":"kilometers"}}}`,
+			" WHERE ST_Distance_Sphere(loc, POINT(?, ?)) <= ?", []interface{}{float64(2), float64(1), float64(3000)},
+			" WHERE ST_DWithin(loc::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)", []interface{}{float64(2), float64(1), float64(3000)},
+			`{"loc": {"$near": {"$geometry": {"type": "Point", "coordinates": [2, 1]}, "$maxDistance": 3000}}}`,
+		},
+		{
+			`{"where":{"loc":{"within":{"box":[[0,0],[2,2]]}}}}`,
+			" WHERE ST_Contains(ST_GeomFromText(?), loc)", []interface{}{"POLYGON((0 0, 2 0, 2 2, 0 2, 0 0))"},
+			" WHERE ST_Within(loc, ST_GeomFromText($1, 4326))", []interface{}{"POLYGON((0 0, 2 0, 2 2, 0 2, 0 0))"},
+			`{"loc": {"$geoWithin": {"$geometry": {"type": "Polygon", "coordinates": [[[0, 0], [2, 0], [2, 2], [0, 2], [0, 0]]]}}}}`,
+		},
+		{
+			`{"where":{"title":{"match":{"query":"+quick -slow fox","mode":"boolean"}}}}`,
+			" WHERE MATCH (title) AGAINST (? IN BOOLEAN MODE)", []interface{}{"+quick -slow fox"},
+			" WHERE to_tsvector(title) @@ websearch_to_tsquery($1)", []interface{}{"+quick -slow fox"},
+			`{"$text": {"$search": "+quick -slow fox"}}`,
+		},
+		{
+			`{"where":{"a":1},"order":["a desc","b"],"limit":10,"skip":5}`,
+			" WHERE a = ? ORDER BY a desc, b LIMIT 10 OFFSET 5", []interface{}{float64(1)},
+			" WHERE a = $1 ORDER BY a DESC, b LIMIT 10 OFFSET 5", []interface{}{float64(1)},
+			`{"a": 1}`,
+		},
+		{
+			`{"groupBy":["city"],"aggregate":{"n":{"count":"*"},"s":{"sum":"price"}},"having":{"n":{"gt":2}},"order":"n desc"}`,
+			" GROUP BY city HAVING n > ? ORDER BY n desc", []interface{}{float64(2)},
+			" GROUP BY city HAVING COUNT(*) > $1 ORDER BY n DESC", []interface{}{float64(2)},
+			`{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.filter), &obj); err != nil {
+			t.Fatal(err)
+		}
+
+		f := New()
+		f.Schema = Schema{"doc": TypeJSON, "born": TypeTime, "items.price": TypeInt}
+		f.Build(obj)
+
+		sql, args, err := f.Render("mysql")
+		if err != nil || sql != tt.mysql || !equalArgs(args, tt.mysqlArgs) {
+			t.Errorf("%s: mysql got %q %v %v, want %q %v", tt.filter, sql, args, err, tt.mysql, tt.mysqlArgs)
+		}
+		sql, args, err = f.Render("postgres")
+		if err != nil || sql != tt.postgres || !equalArgs(args, tt.postgresArgs) {
+			t.Errorf("%s: postgres got %q %v %v, want %q %v", tt.filter, sql, args, err, tt.postgres, tt.postgresArgs)
+		}
+		query, _, err := f.Render("mongodb")
+		if err != nil || query != tt.mongodb {
+			t.Errorf("%s: mongodb got %s %v, want %s", tt.filter, query, err, tt.mongodb)
+		}
+	}
+}
+
+// equalArgs compare bound values, times by the instant
+func equalArgs(got, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if t, ok := got[i].(time.Time); ok {
+			if w, ok := want[i].(time.Time); !ok || !t.Equal(w) {
+				return false
+			}
+		} else if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// regex is a where node of an op no built-in dialect knows
+type regex struct{}
+
+func (regex) Child(child Where) {}
+
+func (regex) Condition() Condition {
+	return Condition{Op: "regex", Property: Property{Name: "name"}, Value: "^a"}
+}
+
+func TestRenderUnsupported(t *testing.T) {
+	f := New().And(regex{})
+
+	for _, name := range []string{"mysql", "postgres", "sqlite", "sqlserver", "oracle", "mongodb", "elasticsearch", "clickhouse", "bigquery"} {
+		if _, _, err := f.Render(name); err == nil || err.Error() != "name.regex: "+notSupportOperator {
+			t.Errorf("%s: got %v, want name.regex: %s", name, err, notSupportOperator)
+		}
+	}
+}
+
+func TestMongoDBUnsupported(t *testing.T) {
+	f := New()
+	f.Build(map[string]interface{}{"where": map[string]interface{}{"a": 1.0}})
+	f.Or(regex{})
+
+	if query, err := f.MongoDB(); err == nil {
+		t.Errorf("query got %s, want an error", query)
+	}
+	if pipeline, err := f.MongoDBPipeline(); err == nil {
+		t.Errorf("pipeline got %s, want an error", pipeline)
+	}
+}
+
+func TestRenderOrder(t *testing.T) {
+	f := New()
+	f.Order = Order{"a; DROP TABLE x --"}
+
+	for _, name := range []string{"postgres", "sqlite", "sqlserver", "oracle", "clickhouse", "bigquery"} {
+		if sql, _, err := f.Render(name); err == nil {
+			t.Errorf("%s: got %q, want an error", name, sql)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into DynamoDB condition expressions.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DynamoKey declares the key attributes of a table or an index.
+type DynamoKey struct {
+	Partition string
+	Sort      string
+}
+
+// DynamoQuery holds the expressions of a Query or a Scan request.
+type DynamoQuery struct {
+	// KeyConditionExpression of a Query; empty when where doesn't pin
+	// the partition key, and the request must Scan.
+	KeyCondition string
+
+	// FilterExpression.
+	Filter string
+
+	// ExpressionAttributeNames and ExpressionAttributeValues, the values
+	// to be marshalled into attribute values. Nil when nothing is bound,
+	// DynamoDB rejects empty maps.
+	Names  map[string]string
+	Values map[string]interface{}
+}
+
+// DynamoDB generates the expressions of where. The conditions of the
+// top-level and that a Query can take, eq on the partition key and one
+// condition on the sort key, make the key condition; the others make
+// the filter. Operators DynamoDB cannot evaluate are an error.
+func (f *Filter) DynamoDB(key DynamoKey) (DynamoQuery, error) {
+	d := &dynamo{
+		names: map[string]string{},
+	}
+	if f.Where == nil {
+		return d.query, nil
+	}
+
+	var children []Where
+	if c := f.Where.Condition(); c.Op == OpAnd {
+		children = c.Children
+	} else {
+		children = []Where{f.Where}
+	}
+
+	keys, rest := dynamoKeys(children, key)
+	if keys != nil {
+		// a key condition takes no parentheses
+		str, err := d.terms(keys)
+		if err != nil {
+			return DynamoQuery{}, err
+		}
+		d.query.KeyCondition = strings.Join(str, " AND ")
+	}
+	if rest != nil {
+		str, err := d.and(rest)
+		if err != nil {
+			return DynamoQuery{}, err
+		}
+		d.query.Filter = str
+	}
+
+	return d.query, nil
+}
+
+// dynamoKeys split children into the key condition and the rest. The
+// filter may name no key attribute of a Query, when it would, all of
+// children stay in the filter of a Scan.
+func dynamoKeys(children []Where, key DynamoKey) (keys []Where, rest []Where) {
+	var partition, sort []Where
+
+	for _, child := range children {
+		c := child.Condition()
+		switch {
+		case c.Property.JSON:
+			rest = append(rest, child)
+		case c.Property.Name == key.Partition && key.Partition != "":
+			partition = append(partition, child)
+		case c.Property.Name == key.Sort && key.Sort != "":
+			sort = append(sort, child)
+		default:
+			rest = append(rest, child)
+		}
+	}
+
+	scan := func() ([]Where, []Where) {
+		return nil, children
+	}
+
+	if len(partition) != 1 || partition[0].Condition().Op != OpEq || mentions(rest, key) {
+		return scan()
+	}
+	keys = partition
+
+	switch len(sort) {
+	case 0:
+	case 1:
+		c := sort[0].Condition()
+		switch c.Op {
+		case OpEq, OpLt, OpLte, OpGt, OpGte:
+		case OpLike:
+			if kind, _ := dynamoLike(c.Value.(string)); kind != "prefix" {
+				return scan()
+			}
+		default:
+			return scan()
+		}
+		keys = append(keys, sort...)
+	case 2:
+		// BETWEEN
+		a, b := sort[0].Condition().Op, sort[1].Condition().Op
+		if !(a == OpGte && b == OpLte || a == OpLte && b == OpGte) {
+			return scan()
+		}
+		keys = append(keys, sort...)
+	default:
+		return scan()
+	}
+
+	return keys, rest
+}
+
+// mentions report whether a key attribute appears in children
+func mentions(children []Where, key DynamoKey) bool {
+	isKey := func(p Property) bool {
+		return p.Name != "" && (p.Name == key.Partition || p.Name == key.Sort)
+	}
+
+	for _, child := range children {
+		c := child.Condition()
+		if isKey(c.Property) || mentions(c.Children, key) {
+			return true
+		}
+		for _, p := range c.Properties {
+			if isKey(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dynamoLike classify a like pattern as eq, prefix, contains or any,
+// returning its literal; kind is empty when DynamoDB cannot express it
+func dynamoLike(pattern string) (kind string, literal string) {
+	var wildcards []int
+	var escaped bool
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			literal += string(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			wildcards = append(wildcards, len(literal))
+		case r == '_':
+			return "", ""
+		default:
+			literal += string(r)
+		}
+	}
+
+	switch {
+	case len(wildcards) == 0:
+		return "eq", literal
+	case literal == "":
+		return "any", literal
+	case len(wildcards) == 1 && wildcards[0] == len(literal):
+		return "prefix", literal
+	case len(wildcards) == 2 && wildcards[0] == 0 && wildcards[1] == len(literal):
+		return "contains", literal
+	default:
+		return "", ""
+	}
+}
+
+// dynamo renders DynamoDB expressions, naming attributes #nN and values
+// :vN
+type dynamo struct {
+	names map[string]string
+	query DynamoQuery
+}
+
+// name return the placeholder of the attribute path p
+func (d *dynamo) name(p Property) string {
+	var str []string
+	for _, segment := range strings.Split(p.Name, ".") {
+		n, ok := d.names[segment]
+		if !ok {
+			n = "#n" + strconv.Itoa(len(d.names)+1)
+			d.names[segment] = n
+			if d.query.Names == nil {
+				d.query.Names = map[string]string{}
+			}
+			d.query.Names[n] = segment
+		}
+		str = append(str, n)
+	}
+	return strings.Join(str, ".")
+}
+
+// value return the placeholder of val, times are ISO 8601 strings
+func (d *dynamo) value(val interface{}) string {
+	if t, ok := val.(time.Time); ok {
+		val = t.UTC().Format(time.RFC3339Nano)
+	}
+
+	v := ":v" + strconv.Itoa(len(d.query.Values)+1)
+	if d.query.Values == nil {
+		d.query.Values = map[string]interface{}{}
+	}
+	d.query.Values[v] = val
+	return v
+}
+
+func (d *dynamo) values(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, d.value(val))
+	}
+	return strings.Join(str, ", ")
+}
+
+// and join children, a gte and a lte on one property becoming BETWEEN
+func (d *dynamo) and(children []Where) (string, error) {
+	str, err := d.terms(children)
+	if err != nil {
+		return "", err
+	}
+
+	if len(str) == 1 {
+		return str[0], nil
+	}
+	return "(" + strings.Join(str, " AND ") + ")", nil
+}
+
+// terms render children each, but a pair of gte and lte on one property
+// into one BETWEEN
+func (d *dynamo) terms(children []Where) ([]string, error) {
+	var str []string
+
+	paired := map[int]bool{}
+	for i, child := range children {
+		if paired[i] {
+			continue
+		}
+
+		if j := between(children, i, paired); j >= 0 {
+			paired[j] = true
+			lo, hi := child.Condition(), children[j].Condition()
+			if lo.Op == OpLte {
+				lo, hi = hi, lo
+			}
+			str = append(str, d.name(lo.Property)+" BETWEEN "+d.value(lo.Value)+" AND "+d.value(hi.Value))
+			continue
+		}
+
+		s, err := d.where(child)
+		if err != nil {
+			return nil, err
+		}
+		str = append(str, s)
+	}
+
+	return str, nil
+}
+
+// between return the index of the lte pairing with the gte children[i],
+// or of the gte pairing with the lte
+func between(children []Where, i int, paired map[int]bool) int {
+	c := children[i].Condition()
+
+	var pair Op
+	switch c.Op {
+	case OpGte:
+		pair = OpLte
+	case OpLte:
+		pair = OpGte
+	default:
+		return -1
+	}
+
+	for j, child := range children {
+		if cj := child.Condition(); j > i && !paired[j] && cj.Op == pair && cj.Property == c.Property {
+			return j
+		}
+	}
+	return -1
+}
+
+func (d *dynamo) where(w Where) (string, error) {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return d.and(c.Children)
+	case OpOr:
+		var str []string
+		for _, child := range c.Children {
+			s, err := d.where(child)
+			if err != nil {
+				return "", err
+			}
+			str = append(str, s)
+		}
+		return "(" + strings.Join(str, " OR ") + ")", nil
+	case OpEq:
+		return d.name(c.Property) + " = " + d.value(c.Value), nil
+	case OpNeq:
+		return d.name(c.Property) + " <> " + d.value(c.Value), nil
+	case OpLt:
+		return d.name(c.Property) + " < " + d.value(c.Value), nil
+	case OpLte:
+		return d.name(c.Property) + " <= " + d.value(c.Value), nil
+	case OpGt:
+		return d.name(c.Property) + " > " + d.value(c.Value), nil
+	case OpGte:
+		return d.name(c.Property) + " >= " + d.value(c.Value), nil
+	case OpLike, OpNlike:
+		var str string
+		switch kind, literal := dynamoLike(c.Value.(string)); kind {
+		case "eq":
+			str = d.name(c.Property) + " = " + d.value(literal)
+		case "prefix":
+			str = "begins_with(" + d.name(c.Property) + ", " + d.value(literal) + ")"
+		case "contains":
+			str = "contains(" + d.name(c.Property) + ", " + d.value(literal) + ")"
+		case "any":
+			str = "attribute_exists(" + d.name(c.Property) + ")"
+		default:
+			return "", unsupported("dynamodb", c)
+		}
+		if c.Op == OpNlike {
+			return "NOT " + str, nil
+		}
+		return str, nil
+	case OpIn:
+		return d.name(c.Property) + " IN (" + d.values(c.Values) + ")", nil
+	case OpNin:
+		return "NOT (" + d.name(c.Property) + " IN (" + d.values(c.Values) + "))", nil
+	case OpAfter:
+		return d.where(c.expand())
+	case OpContains:
+		return "contains(" + d.name(c.Property) + ", " + d.value(c.Value) + ")", nil
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			str = append(str, "contains("+d.name(c.Property)+", "+d.value(val)+")")
+		}
+		return "(" + strings.Join(str, " AND ") + ")", nil
+	case OpSize:
+		return "size(" + d.name(c.Property) + ") = " + d.value(c.Value), nil
+	default:
+		return "", unsupported("dynamodb", c)
+	}
+}
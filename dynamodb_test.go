@@ -0,0 +1,97 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDynamoDB(t *testing.T) {
+	key := DynamoKey{Partition: "pk", Sort: "sk"}
+
+	tests := []struct {
+		where        string
+		keyCondition string
+		filter       string
+		err          string
+	}{
+		// the partition key and one condition on the sort key
+		{`{"pk":"u#1"}`, "#n1 = :v1", "", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"gt":5}}]}`, "#n1 = :v1 AND #n2 > :v2", "", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"like":"order#%"}},{"total":{"gte":10}}]}`,
+			"#n1 = :v1 AND begins_with(#n2, :v2)", "#n3 >= :v3", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"gte":1}},{"sk":{"lte":9}}]}`, "#n1 = :v1 AND #n2 BETWEEN :v2 AND :v3", "", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"lte":9}},{"sk":{"gte":1}}]}`, "#n1 = :v1 AND #n2 BETWEEN :v2 AND :v3", "", ""},
+
+		// a sort key condition a Query can't take leaves all to a Scan
+		{`{"and":[{"pk":"u#1"},{"sk":{"like":"%x%"}}]}`, "", "(#n1 = :v1 AND contains(#n2, :v2))", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"in":[1,2]}}]}`, "", "(#n1 = :v1 AND #n2 IN (:v2, :v3))", ""},
+		{`{"and":[{"pk":"u#1"},{"sk":{"gt":1}},{"sk":{"lt":9}}]}`, "", "(#n1 = :v1 AND #n2 > :v2 AND #n2 < :v3)", ""},
+
+		// the partition key not pinned, or named elsewhere
+		{`{"sk":{"gt":5}}`, "", "#n1 > :v1", ""},
+		{`{"pk":{"in":["a","b"]}}`, "", "#n1 IN (:v1, :v2)", ""},
+		{`{"and":[{"pk":"a"},{"pk":"b"}]}`, "", "(#n1 = :v1 AND #n1 = :v2)", ""},
+		{`{"and":[{"pk":"a"},{"or":[{"sk":1},{"x":2}]}]}`, "", "(#n1 = :v1 AND (#n2 = :v2 OR #n3 = :v3))", ""},
+
+		// filter expressions
+		{`{"and":[{"a":{"gte":1}},{"a":{"lte":2}},{"b":{"neq":3}}]}`, "", "(#n1 BETWEEN :v1 AND :v2 AND #n2 <> :v3)", ""},
+		{`{"a":{"nlike":"x"}}`, "", "NOT #n1 = :v1", ""},
+		{`{"a":{"like":"%"}}`, "", "attribute_exists(#n1)", ""},
+		{`{"a":{"nin":[1,2]}}`, "", "NOT (#n1 IN (:v1, :v2))", ""},
+		{`{"tags":{"all":["go","sql"]}}`, "", "(contains(#n1, :v1) AND contains(#n1, :v2))", ""},
+		{`{"tags":{"size":2}}`, "", "size(#n1) = :v1", ""},
+		{`{"address.city":"paris"}`, "", "#n1.#n2 = :v1", ""},
+
+		// what DynamoDB cannot evaluate
+		{`{"a":{"like":"a_c"}}`, "", "", "a.like: " + notSupportOperator},
+		{`{"a":{"like":"a%c"}}`, "", "", "a.like: " + notSupportOperator},
+		{`{"title":{"match":"quick fox"}}`, "", "", "title.match: " + notSupportOperator},
+	}
+
+	for _, tt := range tests {
+		var where interface{}
+		if err := json.Unmarshal([]byte(tt.where), &where); err != nil {
+			t.Fatal(err)
+		}
+
+		f := New().BuildWhere(where)
+		if err := f.Error(); err != nil {
+			t.Fatalf("%s: %v", tt.where, err)
+		}
+
+		q, err := f.DynamoDB(key)
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got %+v %v, want %s", tt.where, q, err, tt.err)
+			}
+		case err != nil || q.KeyCondition != tt.keyCondition || q.Filter != tt.filter:
+			t.Errorf("%s: got %q %q %v, want %q %q", tt.where, q.KeyCondition, q.Filter, err, tt.keyCondition, tt.filter)
+		}
+	}
+}
+
+func TestDynamoDBBound(t *testing.T) {
+	key := DynamoKey{Partition: "pk", Sort: "sk"}
+
+	q, err := New().DynamoDB(key)
+	if err != nil || q.Names != nil || q.Values != nil {
+		t.Errorf("empty where got %+v %v, want nil maps", q, err)
+	}
+
+	f := New().BuildWhere(map[string]interface{}{"and": []interface{}{
+		map[string]interface{}{"pk": "u#1"},
+		map[string]interface{}{"sk": map[string]interface{}{"like": `50\%%`}},
+	}})
+	q, err = f.DynamoDB(key)
+	if err != nil ||
+		!reflect.DeepEqual(q.Names, map[string]string{"#n1": "pk", "#n2": "sk"}) ||
+		!reflect.DeepEqual(q.Values, map[string]interface{}{":v1": "u#1", ":v2": "50%"}) {
+		t.Errorf("got %+v %v", q, err)
+	}
+}
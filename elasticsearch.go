@@ -0,0 +1,193 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into an Elasticsearch search request.
+
+package filter
+
+import (
+	"strconv"
+)
+
+// Elasticsearch generates the body of a _search request: the query,
+// with sort, size and from when f has order, limit and skip
+func (f *Filter) Elasticsearch() (string, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	}
+
+	if f.Where != nil {
+		query, err := esWhere(f.Where, "")
+		if err != nil {
+			return "", err
+		}
+		body["query"] = query
+	}
+	if f.Order != nil {
+		if properties, descs, err := f.Order.keys(); err == nil {
+			var sort []interface{}
+			for i, property := range properties {
+				if descs[i] {
+					sort = append(sort, map[string]interface{}{property: "desc"})
+				} else {
+					sort = append(sort, map[string]interface{}{property: "asc"})
+				}
+			}
+			body["sort"] = sort
+		}
+	}
+	if f.Limit != nil {
+		body["size"] = *f.Limit
+	}
+	if f.Skip != nil {
+		body["from"] = *f.Skip
+	}
+
+	return jsonValue(body), nil
+}
+
+// esWildcard translate a sql like pattern into a wildcard pattern
+func esWildcard(pattern string) string {
+	var str string
+	var escaped bool
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			if r == '*' || r == '?' || r == '\\' {
+				str += `\`
+			}
+			str += string(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			str += "*"
+		case r == '_':
+			str += "?"
+		case r == '*' || r == '?':
+			str += `\` + string(r)
+		default:
+			str += string(r)
+		}
+	}
+
+	return str
+}
+
+func esQuery(kind string, property string, val interface{}) map[string]interface{} {
+	return map[string]interface{}{kind: map[string]interface{}{property: val}}
+}
+
+func esBool(occur string, clauses ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{occur: clauses}}
+}
+
+func esList(children []Where, nested string) ([]interface{}, error) {
+	var clauses []interface{}
+	for _, child := range children {
+		clause, err := esWhere(child, nested)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// esWhere render w, nested is the path of the nested documents
+// properties of an elemMatch belong to
+func esWhere(w Where, nested string) (map[string]interface{}, error) {
+	c := w.Condition()
+
+	property := c.Property.Name
+	if nested != "" {
+		property = nested + "." + property
+	}
+
+	switch c.Op {
+	case OpAnd:
+		clauses, err := esList(c.Children, nested)
+		return esBool("must", clauses...), err
+	case OpOr:
+		clauses, err := esList(c.Children, nested)
+		q := esBool("should", clauses...)
+		q["bool"].(map[string]interface{})["minimum_should_match"] = 1
+		return q, err
+	case OpEq:
+		return esQuery("term", property, c.Value), nil
+	case OpNeq:
+		return esBool("must_not", esQuery("term", property, c.Value)), nil
+	case OpLt, OpLte, OpGt, OpGte:
+		return esQuery("range", property, map[string]interface{}{string(c.Op): c.Value}), nil
+	case OpLike:
+		return esQuery("wildcard", property, map[string]interface{}{"value": esWildcard(c.Value.(string))}), nil
+	case OpNlike:
+		return esBool("must_not", esQuery("wildcard", property, map[string]interface{}{"value": esWildcard(c.Value.(string))})), nil
+	case OpIn:
+		return esQuery("terms", property, c.Values), nil
+	case OpNin:
+		return esBool("must_not", esQuery("terms", property, c.Values)), nil
+	case OpAfter:
+		// search_after needs the sort values of a hit, the seek compares
+		// them instead
+		return esWhere(c.expand(), nested)
+	case OpContains:
+		// an array is a field of many values
+		return esQuery("term", property, c.Value), nil
+	case OpAll:
+		var clauses []interface{}
+		for _, val := range c.Values {
+			clauses = append(clauses, esQuery("term", property, val))
+		}
+		return esBool("must", clauses...), nil
+	case OpSize:
+		// doc values count the distinct values of the array
+		return map[string]interface{}{"script": map[string]interface{}{"script": map[string]interface{}{
+			"source": "doc[params.field].size() == params.size",
+			"params": map[string]interface{}{"field": property, "size": c.Value},
+		}}}, nil
+	case OpElemMatch:
+		query, err := esWhere(c.Where, property)
+		return map[string]interface{}{"nested": map[string]interface{}{
+			"path":  property,
+			"query": query,
+		}}, err
+	case OpNear:
+		return map[string]interface{}{"geo_distance": map[string]interface{}{
+			"distance": strconv.FormatFloat(c.Distance, 'f', -1, 64) + "m",
+			property:   map[string]interface{}{"lat": c.Point.Lat, "lon": c.Point.Lng},
+		}}, nil
+	case OpWithin:
+		var ring [][]float64
+		for _, p := range c.Polygon {
+			ring = append(ring, []float64{p.Lng, p.Lat})
+		}
+		return esQuery("geo_shape", property, map[string]interface{}{
+			"shape":    map[string]interface{}{"type": "polygon", "coordinates": [][][]float64{ring}},
+			"relation": "within",
+		}), nil
+	case OpMatch:
+		var fields []string
+		for _, p := range c.Properties {
+			if nested != "" {
+				fields = append(fields, nested+"."+p.Name)
+			} else {
+				fields = append(fields, p.Name)
+			}
+		}
+
+		if c.Boolean {
+			// +word and -word are the syntax of simple_query_string
+			return map[string]interface{}{"simple_query_string": map[string]interface{}{
+				"query": c.Query, "fields": fields,
+			}}, nil
+		}
+		return map[string]interface{}{"multi_match": map[string]interface{}{
+			"query": c.Query, "fields": fields,
+		}}, nil
+	default:
+		return nil, unsupported("elasticsearch", c)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Name properties: columns, or paths into JSON columns.
+
+package filter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Property is a property named in where. A dotted name whose first
+// segment the schema declares TypeJSON is a path into that JSON column,
+// any other name is a column. Inside elemMatch a name is a path into the
+// array element.
+type Property struct {
+	Name string // e.g. address.city
+	JSON bool
+	Elem bool
+}
+
+var segmentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (f *Filter) property(key string) Property {
+	if f.elem != "" {
+		return Property{key, true, true}
+	}
+
+	i := strings.Index(key, ".")
+	return Property{key, i > 0 && f.Schema[key[:i]] == TypeJSON, false}
+}
+
+// typeOf return the type the schema declares for key, element
+// properties are declared under their array, e.g. items.price
+func (f *Filter) typeOf(key string) (Type, bool) {
+	if f.elem != "" {
+		key = f.elem + "." + key
+	}
+	t, ok := f.Schema[key]
+	return t, ok
+}
+
+// split return the JSON column and the keys of the path inside it,
+// elemColumn standing for the array element
+func (p Property) split(elemColumn string) (string, []string) {
+	segments := strings.Split(p.Name, ".")
+	if p.Elem {
+		return elemColumn, segments
+	}
+	return segments[0], segments[1:]
+}
+
+// mysql return address->>'$.city'
+func (p Property) mysql() string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	column, keys := p.split("elem.value")
+	return column + "->>" + mysqlValue(jsonPath(keys))
+}
+
+// mysqlJSON return address->'$.city', the JSON rather than its text
+func (p Property) mysqlJSON() string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	column, keys := p.split("elem.value")
+	return column + "->" + mysqlValue(jsonPath(keys))
+}
+
+func jsonPath(keys []string) string {
+	path := "$"
+	for _, key := range keys {
+		if segmentRegexp.MatchString(key) {
+			path += "." + key
+		} else {
+			path += `."` + strings.Replace(key, `"`, `\"`, -1) + `"`
+		}
+	}
+	return path
+}
+
+// postgres return address->'geo'->>'city'
+func (p Property) postgres() string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	column, keys := p.split("elem")
+	str := column
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			str += "->>" + postgresValue(key)
+		} else {
+			str += "->" + postgresValue(key)
+		}
+	}
+
+	return str
+}
+
+// postgresJSON return address->'geo'->'city', the JSON rather than
+// its text
+func (p Property) postgresJSON() string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	column, keys := p.split("elem")
+	str := column
+	for _, key := range keys {
+		str += "->" + postgresValue(key)
+	}
+
+	return str
+}
+
+// sqlite return json_extract(address, '$.city')
+func (p Property) sqlite() string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	column, keys := p.split("elem.value")
+	return "json_extract(" + column + ", " + postgresValue(jsonPath(keys)) + ")"
+}
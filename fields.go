@@ -0,0 +1,186 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse the fields filter into a projection.
+
+package filter
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const notAllowed = "not allowed"
+
+// A column, or a path such as table.column or address.city.
+var fieldRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
+// Fields lists the properties to return, every property when empty.
+type Fields []string
+
+// BuildFields analyse Fields, either an array of property names or an
+// object mapping property names to true (include) or false (exclude)
+func (f *Filter) BuildFields(obj interface{}) *Filter {
+	f.Fields = nil
+
+	var fields Fields
+	var err error
+
+	switch o := obj.(type) {
+	case []interface{}:
+		fields, err = processFieldsArray("fields", o)
+	case map[string]interface{}:
+		fields, err = f.processFieldsObj(o)
+	default:
+		logrus.WithFields(logrus.Fields{
+			"filter": "fields",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		err = errors.New(invalidFilter)
+	}
+	if err == nil {
+		err = f.allowFields(fields)
+	}
+	if err != nil {
+		f.err = err
+		return f
+	}
+
+	if len(fields) != 0 {
+		f.Fields = fields
+	}
+
+	return f
+}
+
+func processFieldsArray(filter string, arr []interface{}) (Fields, error) {
+	var fields Fields
+
+	for _, v := range arr {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			logrus.WithFields(logrus.Fields{
+				"filter": filter,
+				"v":      v,
+			}).Error("The v isn't a property name.")
+			return nil, errors.New(notSupportType)
+		}
+		if err := checkField(filter, s); err != nil {
+			return nil, err
+		}
+		fields = append(fields, s)
+	}
+
+	return fields, nil
+}
+
+func (f *Filter) processFieldsObj(obj map[string]interface{}) (Fields, error) {
+	var include, exclude Fields
+
+	for key, val := range obj {
+		b, ok := val.(bool)
+		if !ok {
+			logrus.WithFields(logrus.Fields{
+				"filter": "fields",
+				"key":    key,
+				"val":    val,
+			}).Error("The val isn't a bool.")
+			return nil, errors.New(notSupportType)
+		}
+		if err := checkField("fields", key); err != nil {
+			return nil, err
+		}
+		if b {
+			include = append(include, key)
+		} else {
+			exclude = append(exclude, key)
+		}
+	}
+	sort.Strings(include)
+
+	if len(include) != 0 || len(exclude) == 0 {
+		return include, nil
+	}
+
+	// exclusions alone select every allowed property but them
+	if f.AllowFields == nil {
+		logrus.WithFields(logrus.Fields{
+			"filter": "fields",
+			"obj":    obj,
+		}).Error("Exclusions need an allow-list.")
+		return nil, errors.New(invalidFilter)
+	}
+	for _, name := range f.AllowFields {
+		if !contains(exclude, name) {
+			include = append(include, name)
+		}
+	}
+
+	return include, nil
+}
+
+// checkField check name is a property name, it's selected as is
+func checkField(filter string, name string) error {
+	if fieldRegexp.MatchString(name) {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"filter": filter,
+		"name":   name,
+	}).Error("The name isn't an identifier.")
+	return errors.Wrap(errors.New(invalidIdentifier), filter+"."+name)
+}
+
+// allowFields check every field is in AllowFields
+func (f *Filter) allowFields(fields Fields) error {
+	if f.AllowFields == nil {
+		return nil
+	}
+
+	for _, name := range fields {
+		if !contains(f.AllowFields, name) {
+			logrus.WithFields(logrus.Fields{
+				"filter": "fields",
+				"name":   name,
+			}).Error("The field isn't allowed.")
+			return errors.Wrap(errors.New(notAllowed), "fields."+name)
+		}
+	}
+
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MySQL return the select list
+func (fields Fields) MySQL() string {
+	if len(fields) == 0 {
+		return "*"
+	}
+	return strings.Join([]string(fields), ", ")
+}
+
+// MongoDB return the projection document
+func (fields Fields) MongoDB() string {
+	var str []string
+
+	for _, name := range fields {
+		str = append(str, strconv.Quote(name)+": 1")
+	}
+
+	return "{" + strings.Join(str, ", ") + "}"
+}
@@ -7,8 +7,10 @@
 package filter
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,15 +29,74 @@ type Filter struct {
 	// Specify sort order: ascending or descending.
 	Order
 
+	// Specify properties to return; similar to a SELECT list in SQL.
+	Fields Fields
+
+	// Group instances by properties; similar to GROUP BY in SQL.
+	GroupBy []string
+
+	// Compute aggregates over each group.
+	Aggregates Aggregates
+
+	// Specify group criteria; similar to a HAVING clause in SQL.
+	Having Where
+
+	// Specify related models to fetch along, each with its own filter.
+	Include Includes
+
 	// Limit the number of instances to return.
 	Limit *int64
 
 	// Skip the specified number of instances.
 	Skip *int64
 
+	// Declare property types; where values are coerced into them.
+	Schema Schema
+
+	// Resolve relative time expressions; time.Now when nil.
+	Clock func() time.Time
+
+	// Bound Limit and Skip; unchecked when nil.
+	Policy *Policy
+
+	// Properties Fields may select; any when nil.
+	AllowFields []string
+
+	// Permit UPDATE and DELETE statements without where.
+	AllowEmptyWhere bool
+
+	// Relations Include may fetch.
+	Relations Relations
+
+	// Properties the q search looks into.
+	SearchFields []string
+
+	// Bound the complexity of where, having and order; unbounded when nil.
+	Limits *Limits
+
+	// The cursor seek and-ed into Where by After.
+	seek Where
+
+	// The Limit Build took from Policy.DefaultLimit, the client asking
+	// for none.
+	defaultLimit *int64
+
+	// The array property whose elemMatch is being analysed.
+	elem string
+
+	// The and/or depth and conditions counted against Limits.
+	depth int
+	nodes int
+
 	err error
 }
 
+// Query is a query string and the values bound to its placeholders.
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
 func (f *Filter) Error() error {
 	err := f.err
 	f.err = nil
@@ -49,15 +110,41 @@ func (f *Filter) Build(obj map[string]interface{}) *Filter {
 	if val, ok := obj["where"]; ok {
 		f = f.BuildWhere(val)
 	}
+	if val, ok := obj["q"]; ok {
+		f = f.BuildSearch(val)
+	}
 	if val, ok := obj["order"]; ok {
 		f = f.BuildOrder(val)
 	}
+	if val, ok := obj["fields"]; ok {
+		f = f.BuildFields(val)
+	}
+	if val, ok := obj["groupBy"]; ok {
+		f = f.BuildGroupBy(val)
+	}
+	if val, ok := obj["aggregate"]; ok {
+		f = f.BuildAggregate(val)
+	}
+	if val, ok := obj["having"]; ok {
+		f = f.BuildHaving(val)
+	}
+	if val, ok := obj["include"]; ok {
+		f = f.BuildInclude(val)
+	}
 	if val, ok := obj["limit"]; ok {
 		f = f.BuildLimit(val)
 	}
 	if val, ok := obj["skip"]; ok {
 		f = f.BuildSkip(val)
 	}
+	if val, ok := obj["after"]; ok {
+		f = f.BuildAfter(val)
+	}
+	if f.Limit == nil && f.Policy != nil && f.Policy.DefaultLimit > 0 {
+		f.Limit = new(int64)
+		*f.Limit = f.Policy.DefaultLimit
+		f.defaultLimit = f.Limit
+	}
 
 	return f
 }
@@ -65,10 +152,12 @@ func (f *Filter) Build(obj map[string]interface{}) *Filter {
 // BuildWhere analyse Where
 func (f *Filter) BuildWhere(obj interface{}) *Filter {
 	f.Where = nil
+	f.seek = nil
+	f.resetLimits()
 
 	switch w := obj.(type) {
 	case map[string]interface{}:
-		if where, err := processObj(nil, w); err == nil {
+		if where, err := f.processObj(nil, "where", w); err == nil {
 			f.Where = where
 		} else {
 			f.err = err
@@ -138,16 +227,12 @@ func (f *Filter) Or(where ...Where) *Filter {
 
 // A Where carries a and, a or, and other clauses across
 // API boundaries.
-//
 type Where interface {
 	// Child link child in Parent's children when Parent is andCdt
 	Child(child Where)
 
-	// MySQL return mysql's query string
-	MySQL() string
-
-	// MongoDB return mongodb's query string
-	MongoDB() string
+	// Condition describe the node to a Dialect
+	Condition() Condition
 }
 
 const (
@@ -158,6 +243,7 @@ const (
 	notAnObject     = "not an object"
 	notAnArray      = "not an array"
 	emptyArray      = "empty array"
+	invalidValue    = "invalid value"
 	notSupportType  = "not support type"
 	unknownError    = "unknown error"
 )
@@ -171,6 +257,10 @@ func (cdt *andCdt) Child(child Where) {
 	cdt.children = append(cdt.children, child)
 }
 
+func (cdt *andCdt) Condition() Condition {
+	return Condition{Op: OpAnd, Children: cdt.children}
+}
+
 type orCdt struct {
 	Where
 	children []Where
@@ -180,69 +270,116 @@ func (cdt *orCdt) Child(child Where) {
 	cdt.children = append(cdt.children, child)
 }
 
+func (cdt *orCdt) Condition() Condition {
+	return Condition{Op: OpOr, Children: cdt.children}
+}
+
 type eqCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *eqCdt) Condition() Condition {
+	return Condition{Op: OpEq, Property: cdt.property, Value: cdt.value}
+}
+
 type neqCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *neqCdt) Condition() Condition {
+	return Condition{Op: OpNeq, Property: cdt.property, Value: cdt.value}
+}
+
 type ltCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *ltCdt) Condition() Condition {
+	return Condition{Op: OpLt, Property: cdt.property, Value: cdt.value}
+}
+
 type lteCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *lteCdt) Condition() Condition {
+	return Condition{Op: OpLte, Property: cdt.property, Value: cdt.value}
+}
+
 type gtCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *gtCdt) Condition() Condition {
+	return Condition{Op: OpGt, Property: cdt.property, Value: cdt.value}
+}
+
 type gteCdt struct {
 	Where
-	property string
+	property Property
 	value    interface{}
 }
 
+func (cdt *gteCdt) Condition() Condition {
+	return Condition{Op: OpGte, Property: cdt.property, Value: cdt.value}
+}
+
 type likeCdt struct {
 	Where
-	property string
+	property Property
 	value    string
 }
 
+func (cdt *likeCdt) Condition() Condition {
+	return Condition{Op: OpLike, Property: cdt.property, Value: cdt.value}
+}
+
 type nlikeCdt struct {
 	Where
-	property string
+	property Property
 	value    string
 }
 
+func (cdt *nlikeCdt) Condition() Condition {
+	return Condition{Op: OpNlike, Property: cdt.property, Value: cdt.value}
+}
+
 type inCdt struct {
 	Where
-	property string
-	datatype string // 's' 'n' 'b'
+	property Property
+	datatype string // 's' 'n' 'b' 't'
 	values   []interface{}
 }
 
+func (cdt *inCdt) Condition() Condition {
+	return Condition{Op: OpIn, Property: cdt.property, Values: cdt.values}
+}
+
 type ninCdt struct {
 	Where
-	property string
-	datatype string // 's' 'n' 'b'
+	property Property
+	datatype string // 's' 'n' 'b' 't'
 	values   []interface{}
 }
 
-func processObj(parent Where, obj map[string]interface{}) (Where, error) {
+func (cdt *ninCdt) Condition() Condition {
+	return Condition{Op: OpNin, Property: cdt.property, Values: cdt.values}
+}
+
+func (f *Filter) processObj(parent Where, path string, obj map[string]interface{}) (Where, error) {
+	if err := f.limitNode(path); err != nil {
+		return nil, err
+	}
 	if len(obj) != 1 {
 		logrus.WithFields(logrus.Fields{
 			"obj": obj,
@@ -262,7 +399,7 @@ func processObj(parent Where, obj map[string]interface{}) (Where, error) {
 				}).Error("The val isn't an array.")
 				return nil, errors.New(notAnArray)
 			}
-			return compoundCdt(parent, keyword, arr)
+			return f.compoundCdt(parent, path+"."+key, keyword, arr)
 		case "NEQ", "LT", "LTE", "GT", "GTE", "IN", "NIN":
 			logrus.WithFields(logrus.Fields{
 				"key": key,
@@ -270,7 +407,7 @@ func processObj(parent Where, obj map[string]interface{}) (Where, error) {
 			}).Error("The key shouldn't be keyword.")
 			return nil, errors.New(reservedKeyword)
 		default:
-			return primitiveCdt(parent, key, val)
+			return f.primitiveCdt(parent, path+"."+key, key, val)
 		}
 	}
 
@@ -280,7 +417,7 @@ func processObj(parent Where, obj map[string]interface{}) (Where, error) {
 	return nil, errors.New(unknownError)
 }
 
-func compoundCdt(parent Where, key string, val []interface{}) (Where, error) {
+func (f *Filter) compoundCdt(parent Where, path string, key string, val []interface{}) (Where, error) {
 	if len(val) == 0 {
 		logrus.WithFields(logrus.Fields{
 			"key": key,
@@ -289,6 +426,12 @@ func compoundCdt(parent Where, key string, val []interface{}) (Where, error) {
 		return nil, errors.New(emptyArray)
 	}
 
+	f.depth++
+	defer func() { f.depth-- }()
+	if err := f.limitDepth(path); err != nil {
+		return nil, err
+	}
+
 	var cdt Where
 
 	if key == "AND" {
@@ -297,7 +440,7 @@ func compoundCdt(parent Where, key string, val []interface{}) (Where, error) {
 		cdt = &orCdt{parent, []Where{}}
 	}
 
-	for _, v := range val {
+	for i, v := range val {
 		obj, ok := v.(map[string]interface{})
 		if !ok {
 			logrus.WithFields(logrus.Fields{
@@ -306,7 +449,7 @@ func compoundCdt(parent Where, key string, val []interface{}) (Where, error) {
 			}).Error("The v isn't an object.")
 			return nil, errors.New(notAnObject)
 		}
-		if child, err := processObj(cdt, obj); err == nil {
+		if child, err := f.processObj(cdt, fmt.Sprintf("%s[%d]", path, i), obj); err == nil {
 			cdt.Child(child)
 		} else {
 			return nil, err
@@ -316,15 +459,28 @@ func compoundCdt(parent Where, key string, val []interface{}) (Where, error) {
 	return cdt, nil
 }
 
-func primitiveCdt(parent Where, key string, val interface{}) (Where, error) {
+func (f *Filter) primitiveCdt(parent Where, path string, key string, val interface{}) (Where, error) {
+	// the key is written into the query as is
+	if !fieldRegexp.MatchString(key) {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+		}).Error("The key isn't a property name.")
+		return nil, errors.Wrap(errors.New(invalidIdentifier), path)
+	}
+
 	op := "eq"
 	switch v := val.(type) {
-	case string:
-		return &eqCdt{parent, key, "'" + v + "'"}, nil
-	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-		return &eqCdt{parent, key, val}, nil
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		if err := f.limitString(path, v); err != nil {
+			return nil, err
+		}
+		value, err := f.coerce(path, key, v)
+		if err != nil {
+			return nil, err
+		}
+		return &eqCdt{parent, f.property(key), value}, nil
 	case map[string]interface{}:
-		return primitiveCdtStd(parent, key, v)
+		return f.primitiveCdtStd(parent, path, key, v)
 	default:
 		logrus.WithFields(logrus.Fields{
 			"key": key,
@@ -335,7 +491,14 @@ func primitiveCdt(parent Where, key string, val interface{}) (Where, error) {
 	}
 }
 
-func primitiveCdtStd(parent Where, key string, obj map[string]interface{}) (Where, error) {
+func (f *Filter) primitiveCdtStd(parent Where, path string, key string, obj map[string]interface{}) (Where, error) {
+	// near takes its maxDistance and unit alongside
+	for op := range obj {
+		if strings.EqualFold(op, "near") {
+			return f.processNear(parent, path, key, obj)
+		}
+	}
+
 	if len(obj) != 1 {
 		logrus.WithFields(logrus.Fields{
 			"obj": obj,
@@ -344,26 +507,39 @@ func primitiveCdtStd(parent Where, key string, obj map[string]interface{}) (Wher
 	}
 
 	for op, val := range obj {
+		path := path + "." + op
 		op = strings.ToUpper(op)
 		switch op {
 		case "NEQ":
-			return processNeq(parent, key, "neq", val)
+			return f.processNeq(parent, path, key, "neq", val)
 		case "LT":
-			return processLt(parent, key, "lt", val)
+			return f.processLt(parent, path, key, "lt", val)
 		case "LTE":
-			return processLte(parent, key, "lte", val)
+			return f.processLte(parent, path, key, "lte", val)
 		case "GT":
-			return processGt(parent, key, "gt", val)
+			return f.processGt(parent, path, key, "gt", val)
 		case "GTE":
-			return processGte(parent, key, "gte", val)
+			return f.processGte(parent, path, key, "gte", val)
 		case "LIKE":
-			return processLike(parent, key, "like", val)
+			return f.processLike(parent, path, key, "like", val)
 		case "NLIKE":
-			return processNlike(parent, key, "nlike", val)
+			return f.processNlike(parent, path, key, "nlike", val)
 		case "IN":
-			return processIn(parent, key, "in", val)
+			return f.processIn(parent, path, key, "in", val)
 		case "NIN":
-			return processNin(parent, key, "nin", val)
+			return f.processNin(parent, path, key, "nin", val)
+		case "CONTAINS":
+			return f.processContains(parent, path, key, "contains", val)
+		case "ALL":
+			return f.processAll(parent, path, key, "all", val)
+		case "SIZE":
+			return f.processSize(parent, path, key, "size", val)
+		case "ELEMMATCH":
+			return f.processElemMatch(parent, path, key, "elemMatch", val)
+		case "WITHIN":
+			return f.processWithin(parent, path, key, "within", val)
+		case "MATCH", "SEARCH":
+			return f.processMatch(parent, path, key, "match", val)
 		default:
 			logrus.WithFields(logrus.Fields{
 				"key": key,
@@ -381,12 +557,17 @@ func primitiveCdtStd(parent Where, key string, obj map[string]interface{}) (Wher
 	return nil, errors.New(unknownError)
 }
 
-func processNeq(parent Where, key string, op string, val interface{}) (Where, error) {
-	switch s := val.(type) {
-	case string:
-		return &neqCdt{parent, key, "'" + s + "'"}, nil
-	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-		return &neqCdt{parent, key, val}, nil
+func (f *Filter) processNeq(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	switch val.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		if err := f.limitString(path, val); err != nil {
+			return nil, err
+		}
+		value, err := f.coerce(path, key, val)
+		if err != nil {
+			return nil, err
+		}
+		return &neqCdt{parent, f.property(key), value}, nil
 	default:
 		logrus.WithFields(logrus.Fields{
 			"key": key,
@@ -397,8 +578,8 @@ func processNeq(parent Where, key string, op string, val interface{}) (Where, er
 	}
 }
 
-func processLt(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processNeq(parent, key, op, val)
+func (f *Filter) processLt(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processNeq(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -407,8 +588,8 @@ func processLt(parent Where, key string, op string, val interface{}) (Where, err
 	return &ltCdt{neq.Where, neq.property, neq.value}, nil
 }
 
-func processLte(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processNeq(parent, key, op, val)
+func (f *Filter) processLte(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processNeq(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -417,8 +598,8 @@ func processLte(parent Where, key string, op string, val interface{}) (Where, er
 	return &lteCdt{neq.Where, neq.property, neq.value}, nil
 }
 
-func processGt(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processNeq(parent, key, op, val)
+func (f *Filter) processGt(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processNeq(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -427,8 +608,8 @@ func processGt(parent Where, key string, op string, val interface{}) (Where, err
 	return &gtCdt{neq.Where, neq.property, neq.value}, nil
 }
 
-func processGte(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processNeq(parent, key, op, val)
+func (f *Filter) processGte(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processNeq(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -437,10 +618,13 @@ func processGte(parent Where, key string, op string, val interface{}) (Where, er
 	return &gteCdt{neq.Where, neq.property, neq.value}, nil
 }
 
-func processLike(parent Where, key string, op string, val interface{}) (Where, error) {
+func (f *Filter) processLike(parent Where, path string, key string, op string, val interface{}) (Where, error) {
 	switch s := val.(type) {
 	case string:
-		return &likeCdt{parent, key, "'" + s + "'"}, nil
+		if err := f.limitString(path, s); err != nil {
+			return nil, err
+		}
+		return &likeCdt{parent, f.property(key), s}, nil
 	default:
 		logrus.WithFields(logrus.Fields{
 			"key": key,
@@ -451,8 +635,8 @@ func processLike(parent Where, key string, op string, val interface{}) (Where, e
 	}
 }
 
-func processNlike(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processLike(parent, key, op, val)
+func (f *Filter) processNlike(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processLike(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -461,7 +645,7 @@ func processNlike(parent Where, key string, op string, val interface{}) (Where,
 	return &nlikeCdt{like.Where, like.property, like.value}, nil
 }
 
-func processIn(parent Where, key string, op string, val interface{}) (Where, error) {
+func (f *Filter) processIn(parent Where, path string, key string, op string, val interface{}) (Where, error) {
 	arr, ok := val.([]interface{})
 	if !ok {
 		logrus.WithFields(logrus.Fields{
@@ -480,9 +664,30 @@ func processIn(parent Where, key string, op string, val interface{}) (Where, err
 		return nil, errors.New(emptyArray)
 	}
 
+	if err := f.limitValues(path, arr); err != nil {
+		return nil, err
+	}
+	for i, v := range arr {
+		if err := f.limitString(fmt.Sprintf("%s[%d]", path, i), v); err != nil {
+			return nil, err
+		}
+	}
+
 	var datatype string
 	var values []interface{}
 
+	if t, ok := f.typeOf(key); ok {
+		for i, v := range arr {
+			value, err := f.coerce(fmt.Sprintf("%s[%d]", path, i), key, v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		datatype = t.datatype()
+		goto ret
+	}
+
 	for _, v := range arr {
 		switch v.(type) {
 		case string:
@@ -508,7 +713,7 @@ s:
 	for _, v := range arr {
 		switch s := v.(type) {
 		case string:
-			values = append(values, "'"+s+"'")
+			values = append(values, s)
 		}
 	}
 	goto ret
@@ -532,11 +737,11 @@ b:
 	goto ret
 
 ret:
-	return &inCdt{parent, key, datatype, values}, nil
+	return &inCdt{parent, f.property(key), datatype, values}, nil
 }
 
-func processNin(parent Where, key string, op string, val interface{}) (Where, error) {
-	w, err := processIn(parent, key, op, val)
+func (f *Filter) processNin(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	w, err := f.processIn(parent, path, key, op, val)
 	if err != nil {
 		return nil, err
 	}
@@ -569,6 +774,15 @@ func (f *Filter) BuildOrder(obj interface{}) *Filter {
 	if len(f.Order) == 0 {
 		f.Order = nil
 	}
+	if err := f.limitOrder(f.Order); err != nil {
+		f.Order = nil
+		f.err = err
+	}
+	// the order is written into the query as is
+	if _, err := f.Order.orderBy(asIs); err != nil {
+		f.Order = nil
+		f.err = err
+	}
 
 	return f
 }
@@ -593,6 +807,12 @@ func (f *Filter) BuildLimit(obj interface{}) *Filter {
 		f.Limit = new(int64)
 		v := reflect.ValueOf(l).Convert(reflect.TypeOf(*f.Limit))
 		*f.Limit = v.Int()
+		if f.Policy != nil {
+			if err := f.Policy.limit(f.Limit); err != nil {
+				f.Limit = nil
+				f.err = err
+			}
+		}
 	default:
 		logrus.WithFields(logrus.Fields{
 			"filter": "limit",
@@ -613,6 +833,12 @@ func (f *Filter) BuildSkip(obj interface{}) *Filter {
 		f.Skip = new(int64)
 		v := reflect.ValueOf(l).Convert(reflect.TypeOf(*f.Skip))
 		*f.Skip = v.Int()
+		if f.Policy != nil {
+			if err := f.Policy.skip(f.Skip); err != nil {
+				f.Skip = nil
+				f.err = err
+			}
+		}
 	default:
 		logrus.WithFields(logrus.Fields{
 			"filter": "skip",
@@ -0,0 +1,247 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse geospatial operators on point properties.
+
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Point is a location on earth in degrees.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// Mean radius of the earth in meters.
+const earthRadius = 6371008.8
+
+// Meters per distance unit.
+var units = map[string]float64{
+	"meters":     1,
+	"kilometers": 1000,
+	"miles":      1609.344,
+	"feet":       0.3048,
+}
+
+// The point lies within maxDistance meters of point.
+type nearCdt struct {
+	Where
+	property    Property
+	point       Point
+	maxDistance float64
+}
+
+func (cdt *nearCdt) Condition() Condition {
+	return Condition{Op: OpNear, Property: cdt.property, Point: cdt.point, Distance: cdt.maxDistance}
+}
+
+// The point lies within polygon, a closed ring.
+type withinCdt struct {
+	Where
+	property Property
+	polygon  []Point
+}
+
+func (cdt *withinCdt) Condition() Condition {
+	return Condition{Op: OpWithin, Property: cdt.property, Polygon: cdt.polygon}
+}
+
+// parsePoint accept "lat,lng", [lat, lng], {"lat": lat, "lng": lng}
+// and Point
+func parsePoint(val interface{}) (Point, bool) {
+	var lat, lng interface{}
+
+	switch v := val.(type) {
+	case Point:
+		return v, true
+	case string:
+		s := strings.Split(v, ",")
+		if len(s) != 2 {
+			return Point{}, false
+		}
+		lat, lng = strings.TrimSpace(s[0]), strings.TrimSpace(s[1])
+	case []interface{}:
+		if len(v) != 2 {
+			return Point{}, false
+		}
+		lat, lng = v[0], v[1]
+	case map[string]interface{}:
+		lat, lng = v["lat"], v["lng"]
+	default:
+		return Point{}, false
+	}
+
+	y, ok := coerceValue(TypeFloat, lat, time.Time{})
+	if !ok {
+		return Point{}, false
+	}
+	x, ok := coerceValue(TypeFloat, lng, time.Time{})
+	if !ok {
+		return Point{}, false
+	}
+	p := Point{y.(float64), x.(float64)}
+
+	return p, math.Abs(p.Lat) <= 90 && math.Abs(p.Lng) <= 180
+}
+
+// processNear analyse {"near": point, "maxDistance": n, "unit": unit},
+// the unit defaults to miles
+func (f *Filter) processNear(parent Where, path string, key string, obj map[string]interface{}) (Where, error) {
+	var near, maxDistance, unit interface{} = nil, nil, "miles"
+
+	for k, v := range obj {
+		switch strings.ToUpper(k) {
+		case "NEAR":
+			near = v
+		case "MAXDISTANCE":
+			maxDistance = v
+		case "UNIT":
+			unit = v
+		default:
+			logrus.WithFields(logrus.Fields{
+				"key": key,
+				"op":  k,
+				"val": v,
+			}).Error("The op is invalid keyword.")
+			return nil, errors.New(invalidKeyword)
+		}
+	}
+
+	point, ok := parsePoint(near)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"val": near,
+		}).Error("The val isn't a point.")
+		return nil, errors.Wrap(errors.New(invalidValue), path+".near")
+	}
+	distance, ok := coerceValue(TypeFloat, maxDistance, time.Time{})
+	if _, str := maxDistance.(string); !ok || str || distance.(float64) < 0 {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"val": maxDistance,
+		}).Error("The val isn't a distance.")
+		return nil, errors.Wrap(errors.New(invalidValue), path+".maxDistance")
+	}
+	s, _ := unit.(string)
+	meters, ok := units[strings.ToLower(s)]
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"val": unit,
+		}).Error("The val isn't a unit.")
+		return nil, errors.Wrap(errors.New(invalidValue), path+".unit")
+	}
+
+	return &nearCdt{parent, f.property(key), point, distance.(float64) * meters}, nil
+}
+
+// processWithin analyse {"box": [southwest, northeast]} and
+// {"polygon": [point, point, point, ...]}
+func (f *Filter) processWithin(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		logrus.WithFields(logrus.Fields{
+			"key": key,
+			"op":  op,
+			"val": val,
+		}).Error("The val isn't an object.")
+		return nil, errors.New(notAnObject)
+	}
+
+	for shape, v := range obj {
+		arr, ok := v.([]interface{})
+		if !ok {
+			logrus.WithFields(logrus.Fields{
+				"key":   key,
+				"shape": shape,
+				"v":     v,
+			}).Error("The v isn't an array.")
+			return nil, errors.New(notAnArray)
+		}
+
+		var points []Point
+		for i, p := range arr {
+			point, ok := parsePoint(p)
+			if !ok {
+				logrus.WithFields(logrus.Fields{
+					"key": key,
+					"p":   p,
+				}).Error("The p isn't a point.")
+				return nil, errors.Wrap(errors.New(invalidValue), fmt.Sprintf("%s.%s[%d]", path, shape, i))
+			}
+			points = append(points, point)
+		}
+
+		switch {
+		case strings.EqualFold(shape, "box") && len(points) == 2:
+			sw, ne := points[0], points[1]
+			points = []Point{sw, {sw.Lat, ne.Lng}, ne, {ne.Lat, sw.Lng}}
+		case strings.EqualFold(shape, "polygon") && len(points) >= 3:
+		default:
+			logrus.WithFields(logrus.Fields{
+				"key":   key,
+				"shape": shape,
+				"v":     v,
+			}).Error("The shape is invalid.")
+			return nil, errors.Wrap(errors.New(invalidValue), path+"."+shape)
+		}
+		if points[0] != points[len(points)-1] {
+			points = append(points, points[0])
+		}
+
+		return &withinCdt{parent, f.property(key), points}, nil
+	}
+
+	return nil, errors.New(unknownError)
+}
+
+// haversine return the great-circle distance between a and b in meters
+func haversine(a Point, b Point) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * rad
+	dLng := (b.Lng - a.Lng) * rad
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// inPolygon report whether p lies within the closed ring polygon, by
+// casting a ray along its latitude
+func inPolygon(p Point, polygon []Point) bool {
+	var in bool
+
+	for i := 1; i < len(polygon); i++ {
+		a, b := polygon[i-1], polygon[i]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			in = !in
+		}
+	}
+
+	return in
+}
+
+// wkt return the polygon in well-known text, x being the longitude
+func wkt(polygon []Point) string {
+	var str []string
+
+	for _, p := range polygon {
+		str = append(str, strconv.FormatFloat(p.Lng, 'f', -1, 64)+" "+strconv.FormatFloat(p.Lat, 'f', -1, 64))
+	}
+
+	return "POLYGON((" + strings.Join(str, ", ") + "))"
+}
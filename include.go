@@ -0,0 +1,224 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse the include filter into related models and their scopes.
+
+package filter
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const unknownRelation = "unknown relation"
+
+// Relation describes how the rows of Table relate to a model: the rows
+// whose ForeignKey equals the model's LocalKey.
+type Relation struct {
+	Table      string
+	LocalKey   string
+	ForeignKey string
+
+	// Whether a model has many related rows or only one.
+	Many bool
+
+	// Schema and relations of the related model, for its scope.
+	Schema    Schema
+	Relations Relations
+
+	// Bound the limit and skip of the scope, which apply to each model;
+	// unchecked when nil.
+	Policy *Policy
+}
+
+// Relations registers relations by name.
+type Relations map[string]Relation
+
+// Include fetches the related rows of a relation, filtered by Scope.
+type Include struct {
+	Name string
+	Relation
+	Scope *Filter
+}
+
+// Includes lists the relations to fetch.
+type Includes []Include
+
+// BuildInclude analyse Include, a relation name, an object
+// {"relation": name, "scope": filter}, or an array of them
+func (f *Filter) BuildInclude(obj interface{}) *Filter {
+	f.Include = nil
+
+	var arr []interface{}
+	switch o := obj.(type) {
+	case string, map[string]interface{}:
+		arr = []interface{}{o}
+	case []interface{}:
+		arr = o
+	default:
+		logrus.WithFields(logrus.Fields{
+			"filter": "include",
+			"obj":    obj,
+		}).Error("invalid filter.")
+		f.err = errors.New(invalidFilter)
+		return f
+	}
+
+	var includes Includes
+	for _, v := range arr {
+		include, err := f.processInclude(v)
+		if err != nil {
+			f.err = err
+			return f
+		}
+		includes = append(includes, include)
+	}
+
+	if len(includes) != 0 {
+		f.Include = includes
+	}
+
+	return f
+}
+
+func (f *Filter) processInclude(v interface{}) (Include, error) {
+	var name string
+	var scope map[string]interface{}
+
+	switch o := v.(type) {
+	case string:
+		name = o
+	case map[string]interface{}:
+		var ok bool
+		if name, ok = o["relation"].(string); !ok {
+			logrus.WithFields(logrus.Fields{
+				"filter": "include",
+				"v":      v,
+			}).Error("The relation isn't a name.")
+			return Include{}, errors.New(invalidFilter)
+		}
+		if s, ok := o["scope"]; ok {
+			if scope, ok = s.(map[string]interface{}); !ok {
+				logrus.WithFields(logrus.Fields{
+					"filter": "include",
+					"scope":  s,
+				}).Error("The scope isn't an object.")
+				return Include{}, errors.New(notAnObject)
+			}
+		}
+	default:
+		logrus.WithFields(logrus.Fields{
+			"filter": "include",
+			"v":      v,
+		}).Error("the v isn't supported type")
+		return Include{}, errors.New(notSupportType)
+	}
+
+	relation, ok := f.Relations[name]
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"filter":   "include",
+			"relation": name,
+		}).Error("The relation isn't registered.")
+		return Include{}, errors.Wrap(errors.New(unknownRelation), "include."+name)
+	}
+
+	// the scope is a filter on the related model
+	sub := New()
+	sub.Schema = relation.Schema
+	sub.Relations = relation.Relations
+	sub.Clock = f.Clock
+	sub.Policy = relation.Policy
+	sub.Limits = f.Limits
+	if scope == nil {
+		// the default limit of the policy applies without a scope too
+		scope = map[string]interface{}{}
+	}
+	sub = sub.Build(scope)
+	if err := sub.Error(); err != nil {
+		return Include{}, errors.Wrap(err, "include."+name)
+	}
+	if sub.grouped() && (sub.Limit != nil || sub.Skip != nil) {
+		logrus.WithFields(logrus.Fields{
+			"filter":   "include",
+			"relation": name,
+		}).Error("A grouped scope cannot be paged.")
+		return Include{}, errors.Wrap(errors.New(invalidFilter), "include."+name)
+	}
+
+	return Include{name, relation, sub}, nil
+}
+
+// Select generates the secondary query fetching the related rows of the
+// models whose LocalKey values are keys. ForeignKey is always selected
+// so the rows can be matched back to their models. The limit and skip of
+// the scope page the rows of each model, numbered by ROW_NUMBER() in a
+// column row_num.
+func (inc *Include) Select(keys []interface{}) (Query, error) {
+	if len(keys) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"relation": inc.Name,
+		}).Error("The keys are empty.")
+		return Query{}, errors.New(emptyArray)
+	}
+
+	f := *inc.Scope
+	f.seek = nil
+	f = *f.And(&inCdt{nil, Property{Name: inc.ForeignKey}, "", keys})
+
+	var fields []string
+	if f.Fields != nil && !f.grouped() {
+		fields = append(fields, f.Fields...)
+		if !contains(fields, inc.ForeignKey) {
+			fields = append(fields, inc.ForeignKey)
+		}
+	}
+
+	if f.Limit == nil && f.Skip == nil {
+		return Select(inc.Table, &f, fields...)
+	}
+	return inc.page(&f, fields)
+}
+
+// page generates the secondary query of f paging the rows of each model
+func (inc *Include) page(f *Filter, fields []string) (Query, error) {
+	var order string
+	if f.Order != nil {
+		order = " ORDER BY " + f.Order.MySQL()
+	}
+
+	var skip int64
+	if f.Skip != nil {
+		skip = *f.Skip
+	}
+	rows := " WHERE row_num > " + strconv.FormatInt(skip, 10)
+	if f.Limit != nil {
+		rows += " AND row_num <= " + strconv.FormatInt(skip+*f.Limit, 10)
+	}
+
+	// number the rows of each model, in the order of the scope
+	list := inc.Table + ".*"
+	if fields != nil {
+		list = Fields(fields).MySQL()
+	}
+	numbered := *f
+	numbered.Order, numbered.Limit, numbered.Skip = nil, nil, nil
+
+	if err := checkStatement(inc.Table, &numbered); err != nil {
+		return Query{}, err
+	}
+	sql, args, err := numbered.MySQLArgs()
+	if err != nil {
+		return Query{}, err
+	}
+	inner := "SELECT " + list + ", ROW_NUMBER() OVER (PARTITION BY " + inc.ForeignKey + order + ") AS row_num FROM " +
+		inc.Table + sql
+
+	// the scope's order may name columns scoped doesn't select, row_num
+	// keeps it within each model
+	return Query{"SELECT " + Fields(fields).MySQL() + " FROM (" + inner + ") AS scoped" + rows +
+		" ORDER BY " + inc.ForeignKey + ", row_num", args}, nil
+}
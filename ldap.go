@@ -0,0 +1,173 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into an LDAP search filter.
+
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// An attribute description, a name or an OID with options.
+var attributeRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*|[0-9]+(\.[0-9]+)+)(;[A-Za-z0-9-]+)*$`)
+
+// LDAP generates an RFC 4515 search filter, (objectClass=*) when where
+// is empty. Strict lt and gt rewrite into <= or >= and not equal;
+// operators LDAP cannot express are an error.
+func (f *Filter) LDAP() (string, error) {
+	if f.Where == nil {
+		return "(objectClass=*)", nil
+	}
+	return ldapWhere(f.Where)
+}
+
+// ldapEscape escape the characters special to a filter value
+func ldapEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\5c`, "*", `\2a`, "(", `\28`, ")", `\29`, "\x00", `\00`)
+	return r.Replace(s)
+}
+
+// ldapValue return val as an escaped assertion value, times are
+// GeneralizedTime
+func ldapValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return ldapEscape(v)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return v.UTC().Format("20060102150405.999999") + "Z"
+	default:
+		return ldapEscape(jsonValue(v))
+	}
+}
+
+// ldapSubstring translate a sql like pattern into the value of a
+// substring filter, ok false when it has _
+func ldapSubstring(pattern string) (string, bool) {
+	var segments []string
+	var segment string
+	var escaped bool
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			segment += string(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			segments = append(segments, segment)
+			segment = ""
+		case r == '_':
+			return "", false
+		default:
+			segment += string(r)
+		}
+	}
+	segments = append(segments, segment)
+
+	// a substring filter has no empty substring between two *
+	str := []string{ldapEscape(segments[0])}
+	for i := 1; i < len(segments)-1; i++ {
+		if segments[i] != "" {
+			str = append(str, ldapEscape(segments[i]))
+		}
+	}
+	if len(segments) > 1 {
+		str = append(str, ldapEscape(segments[len(segments)-1]))
+	}
+	return strings.Join(str, "*"), true
+}
+
+// ldapList render children each
+func ldapList(children []Where) (string, error) {
+	var str string
+	for _, child := range children {
+		s, err := ldapWhere(child)
+		if err != nil {
+			return "", err
+		}
+		str += s
+	}
+	return str, nil
+}
+
+func ldapWhere(w Where) (string, error) {
+	c := w.Condition()
+
+	attr := c.Property.Name
+	switch c.Op {
+	case OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte, OpLike, OpNlike, OpIn, OpNin, OpContains, OpAll:
+		if c.Property.JSON || !attributeRegexp.MatchString(attr) {
+			logrus.WithFields(logrus.Fields{
+				"property": attr,
+			}).Error("The property isn't an attribute description.")
+			return "", errors.Wrap(errors.New(invalidKeyword), attr)
+		}
+	}
+
+	switch c.Op {
+	case OpAnd:
+		str, err := ldapList(c.Children)
+		return "(&" + str + ")", err
+	case OpOr:
+		str, err := ldapList(c.Children)
+		return "(|" + str + ")", err
+	case OpEq, OpContains:
+		// an attribute holds many values
+		return "(" + attr + "=" + ldapValue(c.Value) + ")", nil
+	case OpNeq:
+		return "(!(" + attr + "=" + ldapValue(c.Value) + "))", nil
+	case OpLt:
+		// no strict ordering match
+		return "(&(" + attr + "<=" + ldapValue(c.Value) + ")(!(" + attr + "=" + ldapValue(c.Value) + ")))", nil
+	case OpLte:
+		return "(" + attr + "<=" + ldapValue(c.Value) + ")", nil
+	case OpGt:
+		return "(&(" + attr + ">=" + ldapValue(c.Value) + ")(!(" + attr + "=" + ldapValue(c.Value) + ")))", nil
+	case OpGte:
+		return "(" + attr + ">=" + ldapValue(c.Value) + ")", nil
+	case OpLike, OpNlike:
+		substring, ok := ldapSubstring(c.Value.(string))
+		if !ok {
+			return "", unsupported("ldap", c)
+		}
+		if c.Op == OpNlike {
+			return "(!(" + attr + "=" + substring + "))", nil
+		}
+		return "(" + attr + "=" + substring + ")", nil
+	case OpIn, OpNin:
+		var str string
+		for _, val := range c.Values {
+			str += "(" + attr + "=" + ldapValue(val) + ")"
+		}
+		if len(c.Values) != 1 {
+			str = "(|" + str + ")"
+		}
+		if c.Op == OpNin {
+			return "(!" + str + ")", nil
+		}
+		return str, nil
+	case OpAll:
+		var str string
+		for _, val := range c.Values {
+			str += "(" + attr + "=" + ldapValue(val) + ")"
+		}
+		return "(&" + str + ")", nil
+	case OpAfter:
+		return ldapWhere(c.expand())
+	default:
+		return "", unsupported("ldap", c)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLDAPEscape(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"astra", "astra"},
+		{"a*b", `a\2ab`},
+		{"(x)", `\28x\29`},
+		{`a\b`, `a\5cb`},
+		{"a\x00b", `a\00b`},
+		{"*)(uid=*", `\2a\29\28uid=\2a`},
+		{"élan", "élan"},
+	}
+
+	for _, tt := range tests {
+		if got := ldapEscape(tt.s); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLDAPSubstring(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"abc", "abc", true},
+		{"ab%", "ab*", true},
+		{"%ab", "*ab", true},
+		{"%ab%", "*ab*", true},
+		{"a%%b", "a*b", true},
+		{"a%b%c", "a*b*c", true},
+		{"%", "*", true},
+		{`50\%%`, "50%*", true},
+		{`a\_c`, "a_c", true},
+		{"a*(%", `a\2a\28*`, true},
+		{"a_c", "", false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := ldapSubstring(tt.pattern); got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %q %v, want %q %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLDAP(t *testing.T) {
+	tests := []struct {
+		where string
+		want  string
+		err   string
+	}{
+		{`{"cn":"*)(uid=*"}`, `(cn=\2a\29\28uid=\2a)`, ""},
+		{`{"and":[{"cn":"astra"},{"ou":{"neq":"a"}}]}`, `(&(cn=astra)(!(ou=a)))`, ""},
+		{`{"or":[{"age":{"lt":3}},{"age":{"gte":9}}]}`, `(|(&(age<=3)(!(age=3)))(age>=9))`, ""},
+		{`{"cn":{"like":"as*%"}}`, `(cn=as\2a*)`, ""},
+		{`{"cn":{"nlike":"%x"}}`, `(!(cn=*x))`, ""},
+		{`{"ou":{"in":["a","b"]}}`, `(|(ou=a)(ou=b))`, ""},
+		{`{"ou":{"nin":["a"]}}`, `(!(ou=a))`, ""},
+		{`{"active":true}`, `(active=TRUE)`, ""},
+		{`{"cn":{"like":"a_c"}}`, "", "cn.like: " + notSupportOperator},
+		{`{"doc.x":1}`, "", "doc.x: " + invalidKeyword},
+	}
+
+	for _, tt := range tests {
+		var where interface{}
+		if err := json.Unmarshal([]byte(tt.where), &where); err != nil {
+			t.Fatal(err)
+		}
+
+		f := New().BuildWhere(where)
+		if err := f.Error(); err != nil {
+			t.Fatalf("%s: %v", tt.where, err)
+		}
+
+		got, err := f.LDAP()
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got %q %v, want %s", tt.where, got, err, tt.err)
+			}
+		case err != nil || got != tt.want:
+			t.Errorf("%s: got %q %v, want %q", tt.where, got, err, tt.want)
+		}
+	}
+
+	if got, err := New().LDAP(); err != nil || got != "(objectClass=*)" {
+		t.Errorf("empty where got %q %v", got, err)
+	}
+}
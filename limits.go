@@ -0,0 +1,95 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Bound the complexity of a filter to protect the database.
+
+package filter
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tooDeep          = "too deep"
+	tooManyNodes     = "too many conditions"
+	tooManyValues    = "too many values"
+	tooLong          = "too long"
+	tooManyOrderKeys = "too many order keys"
+)
+
+// Limits bound the size of where, having and order. Zero fields are
+// unbounded.
+type Limits struct {
+	// Deepest nesting of and and or.
+	MaxDepth int
+
+	// Most conditions, and and or included.
+	MaxNodes int
+
+	// Longest array of in, nin and all.
+	MaxValues int
+
+	// Longest string value.
+	MaxStringLength int
+
+	// Most order properties.
+	MaxOrderKeys int
+}
+
+// resetLimits start counting the conditions of a new where or having
+func (f *Filter) resetLimits() {
+	f.depth = 0
+	f.nodes = 0
+}
+
+// limitNode count a condition
+func (f *Filter) limitNode(path string) error {
+	f.nodes++
+	if f.Limits == nil || f.Limits.MaxNodes == 0 || f.nodes <= f.Limits.MaxNodes {
+		return nil
+	}
+	return f.exceed(path, tooManyNodes, f.Limits.MaxNodes)
+}
+
+// limitDepth check the depth of an and or or
+func (f *Filter) limitDepth(path string) error {
+	if f.Limits == nil || f.Limits.MaxDepth == 0 || f.depth <= f.Limits.MaxDepth {
+		return nil
+	}
+	return f.exceed(path, tooDeep, f.Limits.MaxDepth)
+}
+
+// limitValues check the length of an array of values
+func (f *Filter) limitValues(path string, arr []interface{}) error {
+	if f.Limits == nil || f.Limits.MaxValues == 0 || len(arr) <= f.Limits.MaxValues {
+		return nil
+	}
+	return f.exceed(path, tooManyValues, f.Limits.MaxValues)
+}
+
+// limitString check the length of val when it is a string
+func (f *Filter) limitString(path string, val interface{}) error {
+	s, ok := val.(string)
+	if !ok || f.Limits == nil || f.Limits.MaxStringLength == 0 || len(s) <= f.Limits.MaxStringLength {
+		return nil
+	}
+	return f.exceed(path, tooLong, f.Limits.MaxStringLength)
+}
+
+// limitOrder check the number of order properties
+func (f *Filter) limitOrder(order Order) error {
+	if f.Limits == nil || f.Limits.MaxOrderKeys == 0 || len(order) <= f.Limits.MaxOrderKeys {
+		return nil
+	}
+	return f.exceed("order", tooManyOrderKeys, f.Limits.MaxOrderKeys)
+}
+
+func (f *Filter) exceed(path string, limit string, max int) error {
+	logrus.WithFields(logrus.Fields{
+		"path": path,
+		"max":  max,
+	}).Error("The filter exceeds the limits.")
+	return errors.Wrap(errors.New(limit), path)
+}
@@ -0,0 +1,359 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Evaluate tree structure against instances held in memory.
+
+package filter
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Match report whether obj satisfies Where
+func (f *Filter) Match(obj map[string]interface{}) bool {
+	if f.Where == nil {
+		return true
+	}
+	return match(f.Where, obj)
+}
+
+// lookup return the property name of obj, following dotted names
+// into nested objects
+func lookup(obj map[string]interface{}, name string) (interface{}, bool) {
+	if val, ok := obj[name]; ok {
+		return val, true
+	}
+
+	var val interface{} = obj
+	for _, key := range strings.Split(name, ".") {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if val, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return val, true
+}
+
+// compare order a and b, ok is false when they are not comparable
+func compare(a interface{}, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return sign(x - y), ok
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(time.Time); ok {
+			t, ok := parseTime(x, y)
+			if !ok {
+				return 0, false
+			}
+			return compare(t, y)
+		}
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, false
+		case x == y:
+			return 0, true
+		case y:
+			return -1, true
+		default:
+			return 1, true
+		}
+	case time.Time:
+		switch y := b.(type) {
+		case time.Time:
+			return sign(float64(x.Sub(y))), true
+		case string:
+			n, ok := compare(b, a)
+			return -n, ok
+		}
+	}
+
+	return 0, false
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float(), true
+	}
+	return 0, false
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// matchCompare report whether the property of obj compares to value as
+// one of want
+func matchCompare(obj map[string]interface{}, p Property, value interface{}, want ...int) bool {
+	val, ok := lookup(obj, p.Name)
+	if !ok {
+		return false
+	}
+	n, ok := compare(val, value)
+	if !ok {
+		return false
+	}
+	for _, w := range want {
+		if n == w {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a interface{}, b interface{}) bool {
+	n, ok := compare(a, b)
+	return ok && n == 0
+}
+
+// likeRegexp translate a sql like pattern into an anchored regex
+func likeRegexp(pattern string) string {
+	var re string
+	var escaped bool
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			re += regexp.QuoteMeta(string(r))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			re += ".*"
+		case r == '_':
+			re += "."
+		default:
+			re += regexp.QuoteMeta(string(r))
+		}
+	}
+
+	return "^" + re + "$"
+}
+
+func matchLike(obj map[string]interface{}, p Property, pattern string) (bool, bool) {
+	val, ok := lookup(obj, p.Name)
+	s, str := val.(string)
+	if !ok || !str {
+		return false, false
+	}
+	re, err := regexp.Compile("(?s)" + likeRegexp(pattern))
+	if err != nil {
+		return false, false
+	}
+	return re.MatchString(s), true
+}
+
+func matchIn(obj map[string]interface{}, p Property, values []interface{}) (bool, bool) {
+	val, ok := lookup(obj, p.Name)
+	if !ok {
+		return false, false
+	}
+	for _, v := range values {
+		if equal(val, v) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// elements return the array property of obj
+func elements(obj map[string]interface{}, p Property) ([]interface{}, bool) {
+	val, ok := lookup(obj, p.Name)
+	if !ok || val == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	arr := make([]interface{}, v.Len())
+	for i := range arr {
+		arr[i] = v.Index(i).Interface()
+	}
+	return arr, true
+}
+
+// match report whether obj satisfies w
+func match(w Where, obj map[string]interface{}) bool {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		for _, child := range c.Children {
+			if !match(child, obj) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, child := range c.Children {
+			if match(child, obj) {
+				return true
+			}
+		}
+		return false
+	case OpEq:
+		return matchCompare(obj, c.Property, c.Value, 0)
+	case OpNeq:
+		return matchCompare(obj, c.Property, c.Value, -1, 1)
+	case OpLt:
+		return matchCompare(obj, c.Property, c.Value, -1)
+	case OpLte:
+		return matchCompare(obj, c.Property, c.Value, -1, 0)
+	case OpGt:
+		return matchCompare(obj, c.Property, c.Value, 1)
+	case OpGte:
+		return matchCompare(obj, c.Property, c.Value, 0, 1)
+	case OpLike:
+		matched, _ := matchLike(obj, c.Property, c.Value.(string))
+		return matched
+	case OpNlike:
+		matched, ok := matchLike(obj, c.Property, c.Value.(string))
+		return ok && !matched
+	case OpIn:
+		matched, _ := matchIn(obj, c.Property, c.Values)
+		return matched
+	case OpNin:
+		matched, ok := matchIn(obj, c.Property, c.Values)
+		return ok && !matched
+	case OpAfter:
+		return matchAfter(obj, c)
+	case OpContains:
+		arr, _ := elements(obj, c.Property)
+		for _, v := range arr {
+			if equal(v, c.Value) {
+				return true
+			}
+		}
+		return false
+	case OpAll:
+		arr, ok := elements(obj, c.Property)
+		if !ok {
+			return false
+		}
+		for _, value := range c.Values {
+			var found bool
+			for _, v := range arr {
+				found = found || equal(v, value)
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case OpSize:
+		arr, ok := elements(obj, c.Property)
+		return ok && int64(len(arr)) == c.Value.(int64)
+	case OpElemMatch:
+		arr, _ := elements(obj, c.Property)
+		for _, v := range arr {
+			if elem, ok := v.(map[string]interface{}); ok && match(c.Where, elem) {
+				return true
+			}
+		}
+		return false
+	case OpNear:
+		val, ok := lookup(obj, c.Property.Name)
+		if !ok {
+			return false
+		}
+		p, ok := parsePoint(val)
+		return ok && haversine(c.Point, p) <= c.Distance
+	case OpWithin:
+		val, ok := lookup(obj, c.Property.Name)
+		if !ok {
+			return false
+		}
+		p, ok := parsePoint(val)
+		return ok && inPolygon(p, c.Polygon)
+	case OpMatch:
+		return matchText(obj, c)
+	default:
+		return false
+	}
+}
+
+func matchAfter(obj map[string]interface{}, c Condition) bool {
+	for i, p := range c.Properties {
+		val, ok := lookup(obj, p.Name)
+		if !ok {
+			return false
+		}
+		n, ok := compare(val, c.Values[i])
+		switch {
+		case !ok:
+			return false
+		case n == 0:
+			continue
+		case c.Desc:
+			return n < 0
+		default:
+			return n > 0
+		}
+	}
+	return false
+}
+
+// In natural mode any word of the query matches. In boolean mode every
+// +word is required and no -word may appear; without +words, at least
+// one other word must.
+func matchText(obj map[string]interface{}, c Condition) bool {
+	var text []string
+	for _, p := range c.Properties {
+		if val, ok := lookup(obj, p.Name); ok {
+			if s, ok := val.(string); ok {
+				text = append(text, s)
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	for _, w := range words(strings.Join(text, " ")) {
+		found[w] = true
+	}
+
+	var required, any bool
+	for _, term := range strings.Fields(c.Query) {
+		op := term[0]
+		for _, w := range words(term) {
+			switch {
+			case c.Boolean && op == '+':
+				if !found[w] {
+					return false
+				}
+				required = true
+			case c.Boolean && op == '-':
+				if found[w] {
+					return false
+				}
+			default:
+				any = any || found[w]
+			}
+		}
+	}
+
+	return required || any
+}
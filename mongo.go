@@ -0,0 +1,162 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in MongoDB syntax.
+
+package filter
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoDB generates the query document
+func (f *Filter) MongoDB() (string, error) {
+	if f.Where == nil {
+		return "{}", nil
+	}
+	return mongoWhere(f.Where)
+}
+
+// MongoDB return the sort document
+func (order Order) MongoDB() string {
+	properties, descs, err := order.keys()
+	if err != nil {
+		return "{}"
+	}
+
+	var str []string
+	for i, property := range properties {
+		if descs[i] {
+			str = append(str, strconv.Quote(property)+": -1")
+		} else {
+			str = append(str, strconv.Quote(property)+": 1")
+		}
+	}
+
+	return "{" + strings.Join(str, ", ") + "}"
+}
+
+// mongoValue return the literal of val in mongodb extended json
+func mongoValue(val interface{}) string {
+	switch v := val.(type) {
+	case time.Time:
+		return `{"$date": "` + v.UTC().Format(time.RFC3339Nano) + `"}`
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "null"
+		}
+		return string(b)
+	}
+}
+
+// mongoRegex translate a sql like pattern into an anchored regex
+func mongoRegex(pattern string) string {
+	return strconv.Quote(likeRegexp(pattern))
+}
+
+func mongoField(property string, expr string) string {
+	return "{" + strconv.Quote(property) + ": " + expr + "}"
+}
+
+func mongoValues(values []interface{}) string {
+	var str []string
+
+	for _, val := range values {
+		str = append(str, mongoValue(val))
+	}
+
+	return "[" + strings.Join(str, ", ") + "]"
+}
+
+func mongoPoint(p Point) string {
+	return "[" + mongoValue(p.Lng) + ", " + mongoValue(p.Lat) + "]"
+}
+
+// mongo renders in MongoDB syntax
+type mongo struct {
+	// the first condition mongodb can't render
+	err error
+}
+
+// mongoWhere return the query document of w
+func mongoWhere(w Where) (string, error) {
+	m := &mongo{}
+	query := m.where(w)
+	return query, m.err
+}
+
+func (m *mongo) list(children []Where) string {
+	var str []string
+
+	for _, child := range children {
+		str = append(str, m.where(child))
+	}
+
+	return "[" + strings.Join(str, ", ") + "]"
+}
+
+func (m *mongo) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return `{"$and": ` + m.list(c.Children) + "}"
+	case OpOr:
+		return `{"$or": ` + m.list(c.Children) + "}"
+	case OpEq:
+		return mongoField(c.Property.Name, mongoValue(c.Value))
+	case OpNeq:
+		return mongoField(c.Property.Name, `{"$ne": `+mongoValue(c.Value)+"}")
+	case OpLt:
+		return mongoField(c.Property.Name, `{"$lt": `+mongoValue(c.Value)+"}")
+	case OpLte:
+		return mongoField(c.Property.Name, `{"$lte": `+mongoValue(c.Value)+"}")
+	case OpGt:
+		return mongoField(c.Property.Name, `{"$gt": `+mongoValue(c.Value)+"}")
+	case OpGte:
+		return mongoField(c.Property.Name, `{"$gte": `+mongoValue(c.Value)+"}")
+	case OpLike:
+		return mongoField(c.Property.Name, `{"$regex": `+mongoRegex(c.Value.(string))+"}")
+	case OpNlike:
+		return mongoField(c.Property.Name, `{"$not": {"$regex": `+mongoRegex(c.Value.(string))+"}}")
+	case OpIn:
+		return mongoField(c.Property.Name, `{"$in": `+mongoValues(c.Values)+"}")
+	case OpNin:
+		return mongoField(c.Property.Name, `{"$nin": `+mongoValues(c.Values)+"}")
+	case OpAfter:
+		// no row comparison in mongodb
+		return m.where(c.expand())
+	case OpContains:
+		return mongoField(c.Property.Name, mongoValue(c.Value))
+	case OpAll:
+		return mongoField(c.Property.Name, `{"$all": `+mongoValues(c.Values)+"}")
+	case OpSize:
+		return mongoField(c.Property.Name, `{"$size": `+mongoValue(c.Value)+"}")
+	case OpElemMatch:
+		return mongoField(c.Property.Name, `{"$elemMatch": `+m.where(c.Where)+"}")
+	case OpNear:
+		geometry := `{"type": "Point", "coordinates": ` + mongoPoint(c.Point) + "}"
+		return mongoField(c.Property.Name, `{"$near": {"$geometry": `+geometry+`, "$maxDistance": `+mongoValue(c.Distance)+"}}")
+	case OpWithin:
+		var ring []string
+		for _, p := range c.Polygon {
+			ring = append(ring, mongoPoint(p))
+		}
+
+		geometry := `{"type": "Polygon", "coordinates": [[` + strings.Join(ring, ", ") + "]]}"
+		return mongoField(c.Property.Name, `{"$geoWithin": {"$geometry": `+geometry+"}}")
+	case OpMatch:
+		// $text searches the collection's text index, whatever the properties
+		return `{"$text": {"$search": ` + mongoValue(c.Query) + "}}"
+	default:
+		if m.err == nil {
+			m.err = unsupported("mongodb", c)
+		}
+		return "{}"
+	}
+}
@@ -7,117 +7,208 @@
 package filter
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // MySQL generates filter syntax
 func (f *Filter) MySQL() string {
+	sql, _, _ := (&mysql{inline: true}).filter(f)
+	return sql
+}
+
+// MySQLArgs generates filter syntax with ? placeholders and
+// the values bound to them, or the error of a condition MySQL has no
+// syntax for
+func (f *Filter) MySQLArgs() (string, []interface{}, error) {
+	return (&mysql{}).filter(f)
+}
+
+// MySQLCount generates only the where clause with ? placeholders, for
+// counting every row the filter matches with SELECT COUNT(*). A cursor
+// seek isn't part of the count. A grouped filter counts its groups: the
+// clause carries GROUP BY and HAVING, to be counted in a subquery as
+// Count does.
+func (f *Filter) MySQLCount() (string, []interface{}, error) {
 	var sql string
+	m := &mysql{}
 
-	if f.Where != nil {
-		sql += " WHERE " + f.Where.MySQL()
+	if where := f.unseeked(); where != nil {
+		sql += " WHERE " + m.where(where)
 	}
-	if f.Order != nil {
-		sql += " ORDER BY " + f.Order.MySQL()
-	}
-	if f.Limit != nil {
-		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	if f.GroupBy != nil {
+		sql += " GROUP BY " + strings.Join(f.GroupBy, ", ")
 	}
-	if f.Skip != nil {
-		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
+	if f.Having != nil {
+		sql += " HAVING " + m.where(f.Having)
 	}
 
-	return sql
+	return sql, m.args, m.err
 }
 
-func (order Order) MySQL() string {
-	return strings.Join([]string(order), ", ")
+// MySQLPage generates the fragments for a page of rows and for the
+// count of all rows
+func (f *Filter) MySQLPage() (page Query, count Query, err error) {
+	if page.SQL, page.Args, err = f.MySQLArgs(); err != nil {
+		return Query{}, Query{}, err
+	}
+	if count.SQL, count.Args, err = f.MySQLCount(); err != nil {
+		return Query{}, Query{}, err
+	}
+
+	return page, count, nil
 }
 
-func (cdt *andCdt) MySQL() string {
-	var str = "("
+// mysql renders in MySQL syntax, binding values to ? placeholders
+// unless inline writes them as literals
+type mysql struct {
+	inline bool
+	args   []interface{}
 
-	for i, child := range cdt.children {
-		if i == 0 {
-			str += child.MySQL()
-		} else {
-			str += " AND " + child.MySQL()
-		}
-	}
-	return str + ")"
+	// the first condition mysql can't render
+	err error
 }
 
-func (cdt *orCdt) MySQL() string {
-	var str = "("
+func (m *mysql) filter(f *Filter) (string, []interface{}, error) {
+	var sql string
 
-	for i, child := range cdt.children {
-		if i == 0 {
-			str += child.MySQL()
-		} else {
-			str += " OR " + child.MySQL()
-		}
+	if f.Where != nil {
+		sql += " WHERE " + m.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		sql += " GROUP BY " + strings.Join(f.GroupBy, ", ")
+	}
+	if f.Having != nil {
+		sql += " HAVING " + m.where(f.Having)
+	}
+	if f.Order != nil {
+		sql += " ORDER BY " + f.Order.MySQL()
+	}
+	if f.Limit != nil {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	}
+	if f.Skip != nil {
+		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
 	}
-	return str + ")"
-}
-
-func (cdt *eqCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " = ", cdt.value)
-}
 
-func (cdt *neqCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " != ", cdt.value)
+	return sql, m.args, m.err
 }
 
-func (cdt *ltCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " < ", cdt.value)
+var mysqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// mysqlValue return the literal of val in mysql syntax
+func mysqlValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return "'" + mysqlEscaper.Replace(v) + "'"
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
 }
 
-func (cdt *lteCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " <= ", cdt.value)
+// mark bind val, or write it as a literal when inline
+func (m *mysql) mark(val interface{}) string {
+	if m.inline {
+		return mysqlValue(val)
+	}
+	m.args = append(m.args, val)
+	return "?"
 }
 
-func (cdt *gtCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " > ", cdt.value)
+func (m *mysql) marks(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, m.mark(val))
+	}
+	return strings.Join(str, ", ")
 }
 
-func (cdt *gteCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " >= ", cdt.value)
+func (order Order) MySQL() string {
+	return strings.Join([]string(order), ", ")
 }
 
-func (cdt *likeCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " LIKE ", cdt.value)
+// jsonValue return val encoded as a JSON document
+func jsonValue(val interface{}) string {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
 }
 
-func (cdt *nlikeCdt) MySQL() string {
-	return fmt.Sprint(cdt.property, " NOT LIKE ", cdt.value)
+func (m *mysql) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, m.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
 }
 
-func (cdt *inCdt) MySQL() string {
-	var str string
-
-	for _, val := range cdt.values {
-		if str == "" {
-			str = fmt.Sprint(val)
-		} else {
-			str = fmt.Sprint(str, ", ", val)
+func (m *mysql) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return m.list(c.Children, " AND ")
+	case OpOr:
+		return m.list(c.Children, " OR ")
+	case OpEq:
+		return c.Property.mysql() + " = " + m.mark(c.Value)
+	case OpNeq:
+		return c.Property.mysql() + " != " + m.mark(c.Value)
+	case OpLt:
+		return c.Property.mysql() + " < " + m.mark(c.Value)
+	case OpLte:
+		return c.Property.mysql() + " <= " + m.mark(c.Value)
+	case OpGt:
+		return c.Property.mysql() + " > " + m.mark(c.Value)
+	case OpGte:
+		return c.Property.mysql() + " >= " + m.mark(c.Value)
+	case OpLike:
+		return c.Property.mysql() + " LIKE " + m.mark(c.Value)
+	case OpNlike:
+		return c.Property.mysql() + " NOT LIKE " + m.mark(c.Value)
+	case OpIn:
+		return c.Property.mysql() + " IN (" + m.marks(c.Values) + ")"
+	case OpNin:
+		return c.Property.mysql() + " NOT IN (" + m.marks(c.Values) + ")"
+	case OpAfter:
+		return c.row(m.marks(c.Values))
+	case OpContains:
+		return "JSON_CONTAINS(" + c.Property.mysqlJSON() + ", " + m.mark(jsonValue(c.Value)) + ")"
+	case OpAll:
+		return "JSON_CONTAINS(" + c.Property.mysqlJSON() + ", " + m.mark(jsonValue(c.Values)) + ")"
+	case OpSize:
+		return "JSON_LENGTH(" + c.Property.mysqlJSON() + ") = " + m.mark(c.Value)
+	case OpElemMatch:
+		return "EXISTS (SELECT 1 FROM JSON_TABLE(" + c.Property.mysqlJSON() +
+			", '$[*]' COLUMNS (value JSON PATH '$')) AS elem WHERE " + m.where(c.Where) + ")"
+	case OpNear:
+		return "ST_Distance_Sphere(" + c.Property.mysql() + ", POINT(" + m.mark(c.Point.Lng) + ", " +
+			m.mark(c.Point.Lat) + ")) <= " + m.mark(c.Distance)
+	case OpWithin:
+		return "ST_Contains(ST_GeomFromText(" + m.mark(wkt(c.Polygon)) + "), " + c.Property.mysql() + ")"
+	case OpMatch:
+		var properties []string
+		for _, p := range c.Properties {
+			properties = append(properties, p.mysql())
 		}
-	}
-
-	return fmt.Sprint(cdt.property, " IN (", str, ")")
-}
 
-func (cdt *ninCdt) MySQL() string {
-	var str string
+		mode := " IN NATURAL LANGUAGE MODE)"
+		if c.Boolean {
+			mode = " IN BOOLEAN MODE)"
+		}
 
-	for _, val := range cdt.values {
-		if str == "" {
-			str = fmt.Sprint(val)
-		} else {
-			str = fmt.Sprint(str, ", ", val)
+		return "MATCH (" + strings.Join(properties, ", ") + ") AGAINST (" + m.mark(c.Query) + mode
+	default:
+		if m.err == nil {
+			m.err = unsupported("mysql", c)
 		}
+		return ""
 	}
-
-	return fmt.Sprint(cdt.property, " NOT IN (", str, ")")
 }
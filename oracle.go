@@ -0,0 +1,81 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in Oracle syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Oracle generates filter syntax with :1 placeholders and the values
+// bound to them. Identifiers are quoted, hence case sensitive. Paging
+// needs Oracle 12c.
+func (f *Filter) Oracle() (string, []interface{}, error) {
+	return (&ansi{ansiSyntax: oracle{}, dialect: "oracle"}).filter(f)
+}
+
+type oracle struct{}
+
+func (oracle) quote(identifier string) string {
+	return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+func (oracle) placeholder(n int) string {
+	return ":" + strconv.Itoa(n)
+}
+
+// sql has no boolean before 23c
+func (oracle) bind(val interface{}) interface{} {
+	if b, ok := val.(bool); ok {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return val
+}
+
+func (oracle) contains(array string, mark string) string {
+	return `JSON_EXISTS(` + array + `, '$[*]?(@ == $v)' PASSING ` + mark + ` AS "v")`
+}
+
+func (oracle) size(array string) string {
+	return "JSON_VALUE(" + array + ", '$.size()')"
+}
+
+func (oracle) elemMatch(array string, where string) string {
+	return `EXISTS (SELECT 1 FROM JSON_TABLE(` + array + `, '$[*]' COLUMNS ("value" VARCHAR2(4000) FORMAT JSON PATH '$')) "elem" WHERE ` + where + ")"
+}
+
+func (oracle) near(point string, lng string, lat string, distance string) string {
+	return "SDO_WITHIN_DISTANCE(" + point + ", SDO_GEOMETRY(2001, 4326, SDO_POINT_TYPE(" + lng + ", " + lat +
+		", NULL), NULL, NULL), 'distance=' || " + distance + " || ' unit=M') = 'TRUE'"
+}
+
+func (oracle) within(point string, wkt string) string {
+	return "SDO_INSIDE(" + point + ", SDO_GEOMETRY(" + wkt + ", 4326)) = 'TRUE'"
+}
+
+// Oracle Text searches one column at a time
+func (oracle) match(properties []string, mark string, boolean bool) string {
+	var str []string
+	for _, p := range properties {
+		str = append(str, "CONTAINS("+p+", "+mark+") > 0")
+	}
+	if len(str) == 1 {
+		return str[0]
+	}
+	return "(" + strings.Join(str, " OR ") + ")"
+}
+
+func (oracle) query(q string, boolean bool) string {
+	return fullText(q, boolean, " & ", " | ", " ~ ")
+}
+
+func (oracle) orderNull() string {
+	return "NULL"
+}
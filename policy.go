@@ -0,0 +1,65 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Bound the pages a client may ask for.
+
+package filter
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const outOfRange = "out of range"
+
+// Policy bounds Limit and Skip. Zero fields are unbounded.
+type Policy struct {
+	// Limit used when the filter doesn't specify one.
+	DefaultLimit int64
+
+	// Largest limit a filter may specify.
+	MaxLimit int64
+
+	// Largest skip a filter may specify.
+	MaxSkip int64
+
+	// Clamp out-of-range values into range instead of rejecting them.
+	Clamp bool
+}
+
+// limit check limit is in [1, MaxLimit]
+func (p *Policy) limit(limit *int64) error {
+	switch {
+	case *limit < 1:
+		return p.clamp("limit", limit, 1)
+	case p.MaxLimit > 0 && *limit > p.MaxLimit:
+		return p.clamp("limit", limit, p.MaxLimit)
+	}
+	return nil
+}
+
+// skip check skip is in [0, MaxSkip]
+func (p *Policy) skip(skip *int64) error {
+	switch {
+	case *skip < 0:
+		return p.clamp("skip", skip, 0)
+	case p.MaxSkip > 0 && *skip > p.MaxSkip:
+		return p.clamp("skip", skip, p.MaxSkip)
+	}
+	return nil
+}
+
+func (p *Policy) clamp(filter string, val *int64, bound int64) error {
+	if p.Clamp {
+		*val = bound
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"filter": filter,
+		"val":    *val,
+		"bound":  bound,
+	}).Error("The val is out of range.")
+	return errors.Wrap(errors.New(outOfRange), filter)
+}
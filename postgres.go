@@ -0,0 +1,200 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in PostgreSQL syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Postgres generates filter syntax with $n placeholders and the values
+// bound to them
+func (f *Filter) Postgres() (string, []interface{}, error) {
+	return (&postgres{}).filter(f)
+}
+
+// filter generates filter syntax
+func (pg *postgres) filter(f *Filter) (string, []interface{}, error) {
+	var sql string
+
+	if f.Where != nil {
+		sql += " WHERE " + pg.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		sql += " GROUP BY " + strings.Join(f.GroupBy, ", ")
+	}
+	if f.Having != nil {
+		// HAVING sees the aggregates, not their aliases
+		pg.aliases = f.Aggregates.expressions(asIs)
+		sql += " HAVING " + pg.where(f.Having)
+	}
+	if f.Order != nil {
+		order, err := f.Order.orderBy(asIs)
+		if err != nil {
+			return "", nil, err
+		}
+		sql += " ORDER BY " + order
+	}
+	if f.Limit != nil {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	}
+	if f.Skip != nil {
+		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
+	}
+
+	return sql, pg.args, pg.err
+}
+
+// postgres renders in PostgreSQL syntax, binding values to $n
+// placeholders numbered in order
+type postgres struct {
+	args []interface{}
+
+	// the aggregates of the aliases HAVING compares
+	aliases map[string]string
+
+	// the first condition postgres can't render
+	err error
+}
+
+// postgresValue return the literal of s in postgres syntax
+func postgresValue(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// mark bind val and return its placeholder
+func (pg *postgres) mark(val interface{}) string {
+	pg.args = append(pg.args, val)
+	return "$" + strconv.Itoa(len(pg.args))
+}
+
+func (pg *postgres) marks(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, pg.mark(val))
+	}
+	return strings.Join(str, ", ")
+}
+
+// postgresField return p, cast when it is text extracted from a JSON
+// column compared with a value of another type
+func postgresField(p Property, val interface{}) string {
+	if !p.JSON {
+		return p.Name
+	}
+
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "(" + p.postgres() + ")::numeric"
+	case bool:
+		return "(" + p.postgres() + ")::boolean"
+	case time.Time:
+		return "(" + p.postgres() + ")::timestamptz"
+	default:
+		return p.postgres()
+	}
+}
+
+func (pg *postgres) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, pg.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
+}
+
+// field return the property, or the aggregate of an alias
+func (pg *postgres) field(p Property, val interface{}) string {
+	if expr, ok := pg.aliases[p.Name]; ok {
+		return expr
+	}
+	return postgresField(p, val)
+}
+
+func (pg *postgres) compare(p Property, op string, val interface{}) string {
+	return pg.field(p, val) + " " + op + " " + pg.mark(val)
+}
+
+func (pg *postgres) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return pg.list(c.Children, " AND ")
+	case OpOr:
+		return pg.list(c.Children, " OR ")
+	case OpEq:
+		return pg.compare(c.Property, "=", c.Value)
+	case OpNeq:
+		return pg.compare(c.Property, "!=", c.Value)
+	case OpLt:
+		return pg.compare(c.Property, "<", c.Value)
+	case OpLte:
+		return pg.compare(c.Property, "<=", c.Value)
+	case OpGt:
+		return pg.compare(c.Property, ">", c.Value)
+	case OpGte:
+		return pg.compare(c.Property, ">=", c.Value)
+	case OpLike:
+		return pg.compare(c.Property, "LIKE", c.Value)
+	case OpNlike:
+		return pg.compare(c.Property, "NOT LIKE", c.Value)
+	case OpIn:
+		return pg.field(c.Property, c.Values[0]) + " IN (" + pg.marks(c.Values) + ")"
+	case OpNin:
+		return pg.field(c.Property, c.Values[0]) + " NOT IN (" + pg.marks(c.Values) + ")"
+	case OpAfter:
+		return c.row(pg.marks(c.Values))
+	case OpContains:
+		if c.Property.JSON {
+			return c.Property.postgresJSON() + " @> " + pg.mark(jsonValue([]interface{}{c.Value})) + "::jsonb"
+		}
+		return pg.mark(c.Value) + " = ANY(" + c.Property.Name + ")"
+	case OpAll:
+		if c.Property.JSON {
+			return c.Property.postgresJSON() + " @> " + pg.mark(jsonValue(c.Values)) + "::jsonb"
+		}
+		return c.Property.Name + " @> ARRAY[" + pg.marks(c.Values) + "]"
+	case OpSize:
+		if c.Property.JSON {
+			return "jsonb_array_length(" + c.Property.postgresJSON() + ") = " + pg.mark(c.Value)
+		}
+		return "cardinality(" + c.Property.Name + ") = " + pg.mark(c.Value)
+	case OpElemMatch:
+		return "EXISTS (SELECT 1 FROM jsonb_array_elements(" + c.Property.postgresJSON() + ") AS elem WHERE " + pg.where(c.Where) + ")"
+	case OpNear:
+		return "ST_DWithin(" + c.Property.postgres() + "::geography, ST_SetSRID(ST_MakePoint(" +
+			pg.mark(c.Point.Lng) + ", " + pg.mark(c.Point.Lat) + "), 4326)::geography, " + pg.mark(c.Distance) + ")"
+	case OpWithin:
+		return "ST_Within(" + c.Property.postgres() + ", ST_GeomFromText(" + pg.mark(wkt(c.Polygon)) + ", 4326))"
+	case OpMatch:
+		var properties []string
+		for _, p := range c.Properties {
+			properties = append(properties, "coalesce("+p.postgres()+", '')")
+		}
+
+		document := properties[0]
+		if len(properties) > 1 {
+			document = strings.Join(properties, " || ' ' || ")
+		} else if !c.Properties[0].JSON {
+			document = c.Properties[0].Name
+		}
+
+		tsquery := "plainto_tsquery("
+		if c.Boolean {
+			tsquery = "websearch_to_tsquery("
+		}
+
+		return "to_tsvector(" + document + ") @@ " + tsquery + pg.mark(c.Query) + ")"
+	default:
+		if pg.err == nil {
+			pg.err = unsupported("postgres", c)
+		}
+		return ""
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Build complete MySQL statements around a filter.
+
+package filter
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	invalidIdentifier = "invalid identifier"
+	emptyWhere        = "empty where"
+)
+
+var (
+	// A table may be qualified by its database.
+	tableRegexp  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+	columnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+)
+
+// Select generates a SELECT statement of fields from table filtered by
+// f. Without fields the filter's Fields are selected.
+func Select(table string, f *Filter, fields ...string) (Query, error) {
+	if err := checkStatement(table, f); err != nil {
+		return Query{}, err
+	}
+	for _, field := range fields {
+		if err := checkField("select", field); err != nil {
+			return Query{}, err
+		}
+	}
+
+	sql, args, err := f.MySQLArgs()
+	if err != nil {
+		return Query{}, err
+	}
+	return Query{"SELECT " + f.selectList(fields) + " FROM " + table + sql, args}, nil
+}
+
+// selectList return fields, else the group properties and aggregates
+// of a grouped filter, else the filter's Fields
+func (f *Filter) selectList(fields []string) string {
+	switch {
+	case len(fields) != 0:
+		return Fields(fields).MySQL()
+	case f.grouped():
+		list := strings.Join(f.GroupBy, ", ")
+		if list != "" && f.Aggregates != nil {
+			list += ", "
+		}
+		return list + f.Aggregates.MySQL()
+	default:
+		return f.Fields.MySQL()
+	}
+}
+
+// Count generates a SELECT COUNT(*) statement of the rows of table
+// matched by f
+func Count(table string, f *Filter) (Query, error) {
+	if err := checkStatement(table, f); err != nil {
+		return Query{}, err
+	}
+
+	sql, args, err := f.MySQLCount()
+	if err != nil {
+		return Query{}, err
+	}
+	if !f.grouped() {
+		return Query{"SELECT COUNT(*) FROM " + table + sql, args}, nil
+	}
+
+	// count the groups
+	inner := "SELECT " + f.selectList(nil) + " FROM " + table + sql
+	return Query{"SELECT COUNT(*) FROM (" + inner + ") AS grouped", args}, nil
+}
+
+// Update generates an UPDATE statement setting the columns of set on
+// the rows of table matched by f. It refuses a filter without where
+// unless f.AllowEmptyWhere is set.
+func Update(table string, set map[string]interface{}, f *Filter) (Query, error) {
+	if err := checkStatement(table, f); err != nil {
+		return Query{}, err
+	}
+	if len(set) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"table": table,
+		}).Error("The set is empty.")
+		return Query{}, errors.New(emptyArray)
+	}
+
+	var columns []string
+	for column := range set {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var sql = "UPDATE " + table + " SET "
+	var args []interface{}
+
+	for i, column := range columns {
+		if !columnRegexp.MatchString(column) {
+			logrus.WithFields(logrus.Fields{
+				"column": column,
+			}).Error("The column isn't an identifier.")
+			return Query{}, errors.Wrap(errors.New(invalidIdentifier), "set."+column)
+		}
+		if err := f.allowFields(Fields{column}); err != nil {
+			return Query{}, err
+		}
+
+		value := set[column]
+		switch value.(type) {
+		case nil:
+		case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+			var err error
+			if value, err = f.coerce("set."+column, column, value); err != nil {
+				return Query{}, err
+			}
+		default:
+			logrus.WithFields(logrus.Fields{
+				"column": column,
+				"value":  value,
+			}).Error("the value isn't supported type")
+			return Query{}, errors.New(notSupportType)
+		}
+
+		if i != 0 {
+			sql += ", "
+		}
+		sql += column + " = ?"
+		args = append(args, value)
+	}
+
+	where, a, err := scoped(f)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{sql + where, append(args, a...)}, nil
+}
+
+// Delete generates a DELETE statement of the rows of table matched by
+// f. It refuses a filter without where unless f.AllowEmptyWhere is set.
+func Delete(table string, f *Filter) (Query, error) {
+	if err := checkStatement(table, f); err != nil {
+		return Query{}, err
+	}
+
+	where, args, err := scoped(f)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{"DELETE FROM " + table + where, args}, nil
+}
+
+// scoped generates the where, order and limit clauses MySQL accepts in
+// UPDATE and DELETE. The default limit of the policy, a page size, isn't
+// applied, only a limit the client asked for.
+func scoped(f *Filter) (string, []interface{}, error) {
+	if f.Where == nil && !f.AllowEmptyWhere {
+		logrus.Error("The where is empty.")
+		return "", nil, errors.New(emptyWhere)
+	}
+	if f.Skip != nil {
+		logrus.WithFields(logrus.Fields{
+			"filter": "skip",
+			"obj":    *f.Skip,
+		}).Error("invalid filter.")
+		return "", nil, errors.Wrap(errors.New(invalidFilter), "skip")
+	}
+
+	var sql string
+	var args []interface{}
+
+	if f.Where != nil {
+		m := &mysql{}
+		sql += " WHERE " + m.where(f.Where)
+		if m.err != nil {
+			return "", nil, m.err
+		}
+		args = m.args
+	}
+	if f.Order != nil {
+		sql += " ORDER BY " + f.Order.MySQL()
+	}
+	if f.Limit != nil && f.Limit != f.defaultLimit {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	}
+
+	return sql, args, nil
+}
+
+// checkStatement check table is an identifier and f was built
+// without error
+func checkStatement(table string, f *Filter) error {
+	if !tableRegexp.MatchString(table) {
+		logrus.WithFields(logrus.Fields{
+			"table": table,
+		}).Error("The table isn't an identifier.")
+		return errors.New(invalidIdentifier)
+	}
+
+	return f.err
+}
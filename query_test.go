@@ -0,0 +1,58 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStatementIdentifiers(t *testing.T) {
+	tests := []struct {
+		filter string
+		err    string
+	}{
+		{`{"where":{"1=1 OR id":0}}`, "where.1=1 OR id: " + invalidIdentifier},
+		{`{"where":{"and":[{"a":1},{"b) OR (1":{"gt":0}}]}}`, "where.and[1].b) OR (1: " + invalidIdentifier},
+		{`{"where":{"a":1},"order":"id;DELETE"}`, "order.id;DELETE: " + invalidIdentifier},
+		{`{"where":{"a":1},"order":["a desc","b; DROP TABLE t"]}`, "order: " + invalidOrder},
+	}
+
+	for _, tt := range tests {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.filter), &obj); err != nil {
+			t.Fatal(err)
+		}
+
+		if q, err := Delete("t", New().Build(obj)); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: delete got %q %v, want %s", tt.filter, q.SQL, err, tt.err)
+		}
+		if q, err := Select("t", New().Build(obj)); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: select got %q %v, want %s", tt.filter, q.SQL, err, tt.err)
+		}
+		if q, err := Count("t", New().Build(obj)); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: count got %q %v, want %s", tt.filter, q.SQL, err, tt.err)
+		}
+	}
+}
+
+func TestStatementUnsupported(t *testing.T) {
+	f := New()
+	f.Build(map[string]interface{}{"where": map[string]interface{}{"a": 1.0}})
+	f.And(regex{})
+
+	if q, err := Select("t", f); err == nil {
+		t.Errorf("select got %q, want an error", q.SQL)
+	}
+	if q, err := Count("t", f); err == nil {
+		t.Errorf("count got %q, want an error", q.SQL)
+	}
+	if q, err := Update("t", map[string]interface{}{"x": 1}, f); err == nil {
+		t.Errorf("update got %q, want an error", q.SQL)
+	}
+	if q, err := Delete("t", f); err == nil {
+		t.Errorf("delete got %q, want an error", q.SQL)
+	}
+}
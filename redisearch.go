@@ -0,0 +1,280 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into a RediSearch query.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RediSearch generates the query of FT.SEARCH and the arguments after
+// it, SORTBY for order and LIMIT offset num for limit and skip. Numbers
+// and times, or properties the schema declares so, are numeric fields,
+// other values are tags. Operators RediSearch cannot express are an
+// error, as are an order of more than one property, group by and
+// having.
+func (f *Filter) RediSearch() (string, []string, error) {
+	if f.GroupBy != nil || f.Having != nil {
+		logrus.WithFields(logrus.Fields{
+			"filter": "groupBy",
+		}).Error("invalid filter.")
+		return "", nil, errors.Wrap(errors.New(notSupportOperator), "groupBy")
+	}
+
+	query := "*"
+	if f.Where != nil {
+		rs := redisearch{schema: f.Schema}
+		str, err := rs.where(f.Where)
+		if err != nil {
+			return "", nil, err
+		}
+		query = str
+	}
+
+	var args []string
+	if f.Order != nil {
+		properties, descs, err := f.Order.keys()
+		if err == nil && len(properties) != 1 {
+			// SORTBY takes one field
+			logrus.WithFields(logrus.Fields{
+				"order": f.Order,
+			}).Error("The order has more than one property.")
+			err = errors.New(invalidOrder)
+		}
+		if err != nil {
+			return "", nil, errors.Wrap(err, "order")
+		}
+
+		args = append(args, "SORTBY", properties[0], "ASC")
+		if descs[0] {
+			args[len(args)-1] = "DESC"
+		}
+	}
+	if f.Limit != nil || f.Skip != nil {
+		// RediSearch returns 10 documents when not limited
+		var offset, num int64 = 0, 10
+		if f.Skip != nil {
+			offset = *f.Skip
+		}
+		if f.Limit != nil {
+			num = *f.Limit
+		}
+		args = append(args, "LIMIT", strconv.FormatInt(offset, 10), strconv.FormatInt(num, 10))
+	}
+
+	return query, args, nil
+}
+
+// redisEscape escape the punctuation and the spaces of s, which would
+// otherwise separate tokens
+func redisEscape(s string) string {
+	var str string
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' {
+			str += `\`
+		}
+		str += string(r)
+	}
+	return str
+}
+
+// redisWildcard translate a sql like pattern into a wildcard pattern
+func redisWildcard(pattern string) string {
+	var str string
+	var escaped bool
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			if r == '*' || r == '?' || r == '\\' || r == '\'' {
+				str += `\`
+			}
+			str += string(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			str += "*"
+		case r == '_':
+			str += "?"
+		case r == '*' || r == '?' || r == '\'':
+			str += `\` + string(r)
+		default:
+			str += string(r)
+		}
+	}
+
+	return "w'" + str + "'"
+}
+
+// redisearch renders in RediSearch query syntax
+type redisearch struct {
+	schema Schema
+}
+
+// number return val as the bound of a numeric range, whether it's
+// numeric; times are unix seconds
+func (rs redisearch) number(p Property, val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return jsonValue(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		return strconv.FormatFloat(float64(v.UnixNano())/1e9, 'f', -1, 64), true
+	case string:
+		switch rs.schema[p.Name] {
+		case TypeInt, TypeFloat, TypeDecimal:
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// tag return val as a tag
+func (rs redisearch) tag(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return redisEscape(v)
+	default:
+		return redisEscape(jsonValue(v))
+	}
+}
+
+func (rs redisearch) field(p Property) string {
+	return "@" + redisEscape(p.Name)
+}
+
+// eq return the query of p equal to val
+func (rs redisearch) eq(p Property, val interface{}) string {
+	if n, ok := rs.number(p, val); ok {
+		return rs.field(p) + ":[" + n + " " + n + "]"
+	}
+	return rs.field(p) + ":{" + rs.tag(val) + "}"
+}
+
+// in return the query of p equal to one of values, tags are one query
+func (rs redisearch) in(p Property, values []interface{}) string {
+	var tags, str []string
+	for _, val := range values {
+		if _, ok := rs.number(p, val); ok {
+			str = append(str, rs.eq(p, val))
+		} else {
+			tags = append(tags, rs.tag(val))
+		}
+	}
+	if tags != nil {
+		str = append(str, rs.field(p)+":{"+strings.Join(tags, " | ")+"}")
+	}
+
+	if len(str) == 1 {
+		return str[0]
+	}
+	return "(" + strings.Join(str, " | ") + ")"
+}
+
+func (rs redisearch) list(c Condition, sep string) (string, error) {
+	var str []string
+	for _, child := range c.Children {
+		s, err := rs.where(child)
+		if err != nil {
+			return "", err
+		}
+		str = append(str, s)
+	}
+	return "(" + strings.Join(str, sep) + ")", nil
+}
+
+func (rs redisearch) where(w Where) (string, error) {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return rs.list(c, " ")
+	case OpOr:
+		return rs.list(c, " | ")
+	case OpEq:
+		return rs.eq(c.Property, c.Value), nil
+	case OpNeq:
+		return "-" + rs.eq(c.Property, c.Value), nil
+	case OpLt, OpLte, OpGt, OpGte:
+		n, ok := rs.number(c.Property, c.Value)
+		if !ok {
+			// tags don't compare
+			return "", unsupported("redisearch", c)
+		}
+		switch c.Op {
+		case OpLt:
+			return rs.field(c.Property) + ":[-inf (" + n + "]", nil
+		case OpLte:
+			return rs.field(c.Property) + ":[-inf " + n + "]", nil
+		case OpGt:
+			return rs.field(c.Property) + ":[(" + n + " +inf]", nil
+		default:
+			return rs.field(c.Property) + ":[" + n + " +inf]", nil
+		}
+	case OpLike:
+		return rs.field(c.Property) + ":{" + redisWildcard(c.Value.(string)) + "}", nil
+	case OpNlike:
+		return "-" + rs.field(c.Property) + ":{" + redisWildcard(c.Value.(string)) + "}", nil
+	case OpIn:
+		return rs.in(c.Property, c.Values), nil
+	case OpNin:
+		return "-" + rs.in(c.Property, c.Values), nil
+	case OpAfter:
+		return rs.where(c.expand())
+	case OpContains:
+		// a tag field holds many tags
+		return rs.field(c.Property) + ":{" + rs.tag(c.Value) + "}", nil
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			str = append(str, rs.field(c.Property)+":{"+rs.tag(val)+"}")
+		}
+		return "(" + strings.Join(str, " ") + ")", nil
+	case OpNear:
+		return rs.field(c.Property) + ":[" + strconv.FormatFloat(c.Point.Lng, 'f', -1, 64) + " " +
+			strconv.FormatFloat(c.Point.Lat, 'f', -1, 64) + " " +
+			strconv.FormatFloat(c.Distance, 'f', -1, 64) + " m]", nil
+	case OpMatch:
+		return rs.match(c), nil
+	default:
+		return "", unsupported("redisearch", c)
+	}
+}
+
+// match search the words in the text fields of the properties
+func (rs redisearch) match(c Condition) string {
+	var fields []string
+	for _, p := range c.Properties {
+		fields = append(fields, redisEscape(p.Name))
+	}
+
+	required, optional, excluded := terms(c.Query, c.Boolean)
+
+	var str []string
+	switch {
+	case len(required) != 0:
+		str = append(str, required...)
+	case len(optional) == 1 || len(optional) != 0 && len(excluded) == 0:
+		str = append(str, strings.Join(optional, " | "))
+	case len(optional) != 0:
+		str = append(str, "("+strings.Join(optional, " | ")+")")
+	}
+	for _, w := range excluded {
+		str = append(str, "-"+w)
+	}
+
+	return "@" + strings.Join(fields, "|") + ":(" + strings.Join(str, " ") + ")"
+}
@@ -0,0 +1,171 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Coerce where values into the property types declared by a schema.
+
+package filter
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Type is the declared type of a property.
+type Type int
+
+const (
+	TypeInt Type = iota + 1
+	TypeFloat
+	TypeBool
+	TypeString
+	TypeTime
+	TypeUUID
+	TypeDecimal
+	TypeJSON
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeString:
+		return "string"
+	case TypeTime:
+		return "time"
+	case TypeUUID:
+		return "uuid"
+	case TypeDecimal:
+		return "decimal"
+	case TypeJSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+// datatype return the inCdt datatype of values of this type
+func (t Type) datatype() string {
+	switch t {
+	case TypeInt, TypeFloat, TypeDecimal:
+		return "n"
+	case TypeBool:
+		return "b"
+	case TypeTime:
+		return "t"
+	default:
+		return "s"
+	}
+}
+
+// Schema declares the type of the properties which may appear in where.
+// Properties absent from the schema are passed through untouched.
+type Schema map[string]Type
+
+var (
+	uuidRegexp    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	decimalRegexp = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+)
+
+// coerce convert val into the type declared for key, path locates val in
+// the filter for error reporting.
+func (f *Filter) coerce(path string, key string, val interface{}) (interface{}, error) {
+	t, ok := f.typeOf(key)
+	if !ok {
+		return val, nil
+	}
+
+	v, ok := coerceValue(t, val, f.now())
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"path": path,
+			"type": t,
+			"val":  val,
+		}).Error("The val cannot be converted to the type.")
+		return nil, errors.Wrap(errors.New(invalidValue), path)
+	}
+
+	return v, nil
+}
+
+func coerceValue(t Type, val interface{}, now time.Time) (interface{}, bool) {
+	switch t {
+	case TypeInt:
+		switch v := val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return reflect.ValueOf(v).Convert(reflect.TypeOf(int64(0))).Int(), true
+		case float32, float64:
+			f := reflect.ValueOf(v).Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f > math.MaxInt64 {
+				return nil, false
+			}
+			return int64(f), true
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return n, err == nil
+		}
+	case TypeFloat:
+		switch v := val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float(), true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+	case TypeBool:
+		switch v := val.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		}
+	case TypeString:
+		switch v := val.(type) {
+		case string:
+			return v, true
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+			return fmt.Sprint(v), true
+		}
+	case TypeTime:
+		switch v := val.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			return parseTime(strings.TrimSpace(v), now)
+		}
+	case TypeUUID:
+		switch v := val.(type) {
+		case string:
+			v = strings.TrimSpace(v)
+			return strings.ToLower(v), uuidRegexp.MatchString(v)
+		}
+	case TypeDecimal:
+		switch v := val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return fmt.Sprint(v), true
+		case float32, float64:
+			f := reflect.ValueOf(v).Float()
+			return strconv.FormatFloat(f, 'f', -1, 64), !math.IsInf(f, 0) && !math.IsNaN(f)
+		case string:
+			v = strings.TrimSpace(v)
+			return v, decimalRegexp.MatchString(v)
+		}
+	case TypeJSON:
+		return val, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,203 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse full-text search operators.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The text of properties matches query. In boolean mode words of query
+// prefixed by + are required and by - excluded.
+type matchCdt struct {
+	Where
+	properties []Property
+	query      string
+	boolean    bool
+}
+
+func (cdt *matchCdt) Condition() Condition {
+	return Condition{Op: OpMatch, Properties: cdt.properties, Query: cdt.query, Boolean: cdt.boolean}
+}
+
+// processMatch analyse "query" and {"query": query, "mode": mode}, the
+// mode being natural (the default) or boolean
+func (f *Filter) processMatch(parent Where, path string, key string, op string, val interface{}) (Where, error) {
+	query, boolean, err := parseSearch(path, val)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.limitString(path, query); err != nil {
+		return nil, err
+	}
+
+	return &matchCdt{parent, []Property{f.property(key)}, query, boolean}, nil
+}
+
+// BuildSearch analyse Q, a search of SearchFields and-ed into Where
+func (f *Filter) BuildSearch(obj interface{}) *Filter {
+	if len(f.SearchFields) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"filter": "q",
+			"obj":    obj,
+		}).Error("The search fields are empty.")
+		f.err = errors.New(invalidFilter)
+		return f
+	}
+
+	query, boolean, err := parseSearch("q", obj)
+	if err == nil {
+		err = f.limitString("q", query)
+	}
+	if err != nil {
+		f.err = err
+		return f
+	}
+
+	var properties []Property
+	for _, name := range f.SearchFields {
+		properties = append(properties, f.property(name))
+	}
+
+	return f.And(&matchCdt{nil, properties, query, boolean})
+}
+
+func parseSearch(path string, val interface{}) (string, bool, error) {
+	var query, mode interface{} = val, "natural"
+
+	if obj, ok := val.(map[string]interface{}); ok {
+		query, mode = obj["query"], obj["mode"]
+		if mode == nil {
+			mode = "natural"
+		}
+	}
+
+	q, ok := query.(string)
+	if !ok || strings.TrimSpace(q) == "" {
+		logrus.WithFields(logrus.Fields{
+			"path": path,
+			"val":  val,
+		}).Error("The query isn't a string.")
+		return "", false, errors.Wrap(errors.New(invalidValue), path)
+	}
+
+	var boolean bool
+	m, _ := mode.(string)
+	switch strings.ToLower(m) {
+	case "natural":
+	case "boolean":
+		boolean = true
+	default:
+		logrus.WithFields(logrus.Fields{
+			"path": path,
+			"mode": mode,
+		}).Error("The mode is invalid keyword.")
+		return "", false, errors.New(invalidKeyword)
+	}
+
+	// full-text engines cannot search for nothing, or only exclude
+	if required, optional, _ := terms(q, boolean); len(required) == 0 && len(optional) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"path":  path,
+			"query": q,
+		}).Error("The query has no word to search for.")
+		return "", false, errors.Wrap(errors.New(invalidValue), path)
+	}
+
+	return q, boolean, nil
+}
+
+// words split text into lower case words
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// terms split the words of a search into required, optional and
+// excluded words, only boolean mode has the first and the last
+func terms(q string, boolean bool) (required []string, optional []string, excluded []string) {
+	for _, term := range strings.Fields(q) {
+		for _, w := range words(term) {
+			switch {
+			case boolean && term[0] == '+':
+				required = append(required, w)
+			case boolean && term[0] == '-':
+				excluded = append(excluded, w)
+			default:
+				optional = append(optional, w)
+			}
+		}
+	}
+
+	return required, optional, excluded
+}
+
+// fullText translate a search into words joined by and, or and not
+func fullText(q string, boolean bool, and string, or string, not string) string {
+	required, optional, excluded := terms(q, boolean)
+
+	var str string
+	switch {
+	case len(required) != 0:
+		str = quoteAll(required, and)
+	case len(optional) != 0:
+		str = "(" + quoteAll(optional, or) + ")"
+	}
+	for _, w := range excluded {
+		str += not + strconv.Quote(w)
+	}
+
+	return strings.TrimSpace(str)
+}
+
+// matchTerms and the required words of a search, or else or its
+// optional words, and not its excluded words, token rendering whether
+// the row has a word. A search of no word to look for renders none.
+func matchTerms(q string, boolean bool, token func(w string) string, none string) string {
+	required, optional, excluded := terms(q, boolean)
+
+	var str []string
+	if len(required) != 0 {
+		for _, w := range required {
+			str = append(str, token(w))
+		}
+	} else {
+		var or []string
+		for _, w := range optional {
+			or = append(or, token(w))
+		}
+		switch len(or) {
+		case 0:
+			return none
+		case 1:
+			str = append(str, or[0])
+		default:
+			str = append(str, "("+strings.Join(or, " OR ")+")")
+		}
+	}
+	for _, w := range excluded {
+		str = append(str, "NOT "+token(w))
+	}
+
+	if len(str) == 1 {
+		return str[0]
+	}
+	return "(" + strings.Join(str, " AND ") + ")"
+}
+
+func quoteAll(words []string, sep string) string {
+	var str []string
+	for _, w := range words {
+		str = append(str, strconv.Quote(w))
+	}
+	return strings.Join(str, sep)
+}
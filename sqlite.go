@@ -0,0 +1,192 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in SQLite syntax.
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SQLite generates filter syntax with ? placeholders and the values
+// bound to them
+func (f *Filter) SQLite() (string, []interface{}, error) {
+	return (&sqlite{}).filter(f)
+}
+
+// filter generates filter syntax
+func (lite *sqlite) filter(f *Filter) (string, []interface{}, error) {
+	var sql string
+
+	if f.Where != nil {
+		sql += " WHERE " + lite.where(f.Where)
+	}
+	if f.GroupBy != nil {
+		sql += " GROUP BY " + strings.Join(f.GroupBy, ", ")
+	}
+	if f.Having != nil {
+		sql += " HAVING " + lite.where(f.Having)
+	}
+	if f.Order != nil {
+		order, err := f.Order.orderBy(asIs)
+		if err != nil {
+			return "", nil, err
+		}
+		sql += " ORDER BY " + order
+	}
+	if f.Limit != nil {
+		sql += " LIMIT " + strconv.FormatInt(*f.Limit, 10)
+	} else if f.Skip != nil {
+		// sqlite has no OFFSET without LIMIT
+		sql += " LIMIT -1"
+	}
+	if f.Skip != nil {
+		sql += " OFFSET " + strconv.FormatInt(*f.Skip, 10)
+	}
+
+	return sql, lite.args, lite.err
+}
+
+// sqliteCollate compare strings without regard to case, as the default
+// MySQL collations do
+func sqliteCollate(val interface{}) string {
+	if _, ok := val.(string); ok {
+		return " COLLATE NOCASE"
+	}
+	return ""
+}
+
+// sqlite renders in SQLite syntax, binding values to ? placeholders
+type sqlite struct {
+	args []interface{}
+
+	// the first condition sqlite can't render
+	err error
+}
+
+// mark bind val and return its placeholder
+func (lite *sqlite) mark(val interface{}) string {
+	lite.args = append(lite.args, val)
+	return "?"
+}
+
+func (lite *sqlite) marks(values []interface{}) string {
+	var str []string
+	for _, val := range values {
+		str = append(str, lite.mark(val))
+	}
+	return strings.Join(str, ", ")
+}
+
+func (lite *sqlite) list(children []Where, sep string) string {
+	var str []string
+	for _, child := range children {
+		str = append(str, lite.where(child))
+	}
+	return "(" + strings.Join(str, sep) + ")"
+}
+
+func (lite *sqlite) compare(p Property, op string, val interface{}) string {
+	return p.sqlite() + " " + op + " " + lite.mark(val) + sqliteCollate(val)
+}
+
+// contains return whether the JSON array p holds val
+func (lite *sqlite) contains(p Property, val interface{}) string {
+	return "EXISTS (SELECT 1 FROM json_each(" + p.sqlite() + ") WHERE value = " + lite.mark(val) + ")"
+}
+
+// sqlite has no geometry, points are JSON objects {"lat": lat, "lng": lng}
+func sqlitePoint(p Property) (string, string) {
+	return "json_extract(" + p.sqlite() + ", '$.lat')", "json_extract(" + p.sqlite() + ", '$.lng')"
+}
+
+func (lite *sqlite) where(w Where) string {
+	c := w.Condition()
+
+	switch c.Op {
+	case OpAnd:
+		return lite.list(c.Children, " AND ")
+	case OpOr:
+		return lite.list(c.Children, " OR ")
+	case OpEq:
+		return lite.compare(c.Property, "=", c.Value)
+	case OpNeq:
+		return lite.compare(c.Property, "!=", c.Value)
+	case OpLt:
+		return lite.compare(c.Property, "<", c.Value)
+	case OpLte:
+		return lite.compare(c.Property, "<=", c.Value)
+	case OpGt:
+		return lite.compare(c.Property, ">", c.Value)
+	case OpGte:
+		return lite.compare(c.Property, ">=", c.Value)
+	case OpLike:
+		return c.Property.sqlite() + " LIKE " + lite.mark(c.Value) + ` ESCAPE '\'`
+	case OpNlike:
+		return c.Property.sqlite() + " NOT LIKE " + lite.mark(c.Value) + ` ESCAPE '\'`
+	case OpIn:
+		return c.Property.sqlite() + sqliteCollate(c.Values[0]) + " IN (" + lite.marks(c.Values) + ")"
+	case OpNin:
+		return c.Property.sqlite() + sqliteCollate(c.Values[0]) + " NOT IN (" + lite.marks(c.Values) + ")"
+	case OpAfter:
+		return c.row(lite.marks(c.Values))
+	case OpContains:
+		return lite.contains(c.Property, c.Value)
+	case OpAll:
+		var str []string
+		for _, val := range c.Values {
+			str = append(str, lite.contains(c.Property, val))
+		}
+		return "(" + strings.Join(str, " AND ") + ")"
+	case OpSize:
+		return "json_array_length(" + c.Property.sqlite() + ") = " + lite.mark(c.Value)
+	case OpElemMatch:
+		return "EXISTS (SELECT 1 FROM json_each(" + c.Property.sqlite() + ") AS elem WHERE elem.type = 'object' AND " + lite.where(c.Where) + ")"
+	case OpNear:
+		// The haversine distance, with the math functions of sqlite 3.35.
+		lat, lng := sqlitePoint(c.Property)
+		return fmt.Sprint("2 * ", strconv.FormatFloat(earthRadius, 'f', -1, 64), " * asin(sqrt(",
+			"pow(sin(radians(", lat, " - ", lite.mark(c.Point.Lat), ") / 2), 2) + ",
+			"cos(radians(", lite.mark(c.Point.Lat), ")) * cos(radians(", lat, ")) * pow(sin(radians(", lng, " - ", lite.mark(c.Point.Lng), ") / 2), 2))) <= ",
+			lite.mark(c.Distance))
+	case OpWithin:
+		// A ray cast along the latitude of the point crosses the polygon an
+		// odd number of times when the point lies within.
+		lat, lng := sqlitePoint(c.Property)
+
+		var edges []string
+		for i := 1; i < len(c.Polygon); i++ {
+			a, b := c.Polygon[i-1], c.Polygon[i]
+			if a.Lat == b.Lat {
+				continue
+			}
+			edges = append(edges, "CASE WHEN (("+lat+" > "+lite.mark(a.Lat)+") != ("+lat+" > "+lite.mark(b.Lat)+")) AND "+
+				lng+" < ("+lite.mark((b.Lng-a.Lng)/(b.Lat-a.Lat))+" * ("+lat+" - "+lite.mark(a.Lat)+") + "+lite.mark(a.Lng)+") THEN 1 ELSE 0 END")
+		}
+
+		return "(" + strings.Join(edges, " + ") + ") % 2 = 1"
+	case OpMatch:
+		// fts5 tables match a column against a query of words, "+" and "-"
+		// words of boolean mode become AND and NOT.
+		query := fullText(c.Query, c.Boolean, " AND ", " OR ", " NOT ")
+
+		var str []string
+		for _, p := range c.Properties {
+			str = append(str, p.sqlite()+" MATCH "+lite.mark(query))
+		}
+
+		if len(str) == 1 {
+			return str[0]
+		}
+		return "(" + strings.Join(str, " OR ") + ")"
+	default:
+		if lite.err == nil {
+			lite.err = unsupported("sqlite", c)
+		}
+		return ""
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Stringify tree structure into string in SQL Server syntax.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SQLServer generates filter syntax with @p1 placeholders and the values
+// bound to them. Paging needs an ORDER BY, (SELECT NULL) stands in when
+// the filter has no order.
+func (f *Filter) SQLServer() (string, []interface{}, error) {
+	return (&ansi{ansiSyntax: sqlServer{}, dialect: "sqlserver"}).filter(f)
+}
+
+type sqlServer struct{}
+
+func (sqlServer) quote(identifier string) string {
+	return "[" + strings.Replace(identifier, "]", "]]", -1) + "]"
+}
+
+func (sqlServer) placeholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+func (sqlServer) bind(val interface{}) interface{} {
+	return val
+}
+
+func (sqlServer) contains(array string, mark string) string {
+	return "EXISTS (SELECT 1 FROM OPENJSON(" + array + ") WHERE [value] = " + mark + ")"
+}
+
+func (sqlServer) size(array string) string {
+	return "(SELECT COUNT(*) FROM OPENJSON(" + array + "))"
+}
+
+// type 5 is an object
+func (sqlServer) elemMatch(array string, where string) string {
+	return "EXISTS (SELECT 1 FROM OPENJSON(" + array + ") AS [elem] WHERE [elem].[type] = 5 AND " + where + ")"
+}
+
+func (sqlServer) near(point string, lng string, lat string, distance string) string {
+	return point + ".STDistance(geography::Point(" + lat + ", " + lng + ", 4326)) <= " + distance
+}
+
+func (sqlServer) within(point string, wkt string) string {
+	return point + ".STWithin(geography::STGeomFromText(" + wkt + ", 4326)) = 1"
+}
+
+func (sqlServer) match(properties []string, mark string, boolean bool) string {
+	if boolean {
+		return "CONTAINS((" + strings.Join(properties, ", ") + "), " + mark + ")"
+	}
+	return "FREETEXT((" + strings.Join(properties, ", ") + "), " + mark + ")"
+}
+
+func (sqlServer) query(q string, boolean bool) string {
+	if !boolean {
+		return q
+	}
+	return fullText(q, true, " AND ", " OR ", " AND NOT ")
+}
+
+func (sqlServer) orderNull() string {
+	return "(SELECT NULL)"
+}
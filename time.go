@@ -0,0 +1,93 @@
+// Copyright Astra Xing 2017. All rights reserved.
+// Use of this source code is governed by a GNU-style
+// license that can be found in the LICENSE file.
+
+// Parse absolute and relative time expressions.
+
+package filter
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Layouts accepted for absolute times, tried in order. Layouts without
+// a zone are interpreted in the location of the clock.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// A relative expression is an anchor followed by any number of signed
+// offsets, e.g. "now-7d", "startOfMonth-1M" or "today+9h+30m".
+var (
+	relativeRegexp = regexp.MustCompile(`^(now|today|startOfDay|startOfWeek|startOfMonth|startOfYear)((?:[+-][0-9]+[smhdwMy])*)$`)
+	offsetRegexp   = regexp.MustCompile(`([+-])([0-9]+)([smhdwMy])`)
+)
+
+func (f *Filter) now() time.Time {
+	if f.Clock != nil {
+		return f.Clock()
+	}
+	return time.Now()
+}
+
+// parseTime parse s as an absolute or relative time, relative
+// expressions are resolved against now
+func parseTime(s string, now time.Time) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, true
+		}
+	}
+
+	m := relativeRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	y, mo, d := now.Date()
+	t := now
+	switch m[1] {
+	case "today", "startOfDay":
+		t = time.Date(y, mo, d, 0, 0, 0, 0, now.Location())
+	case "startOfWeek":
+		// weeks start on Monday
+		t = time.Date(y, mo, d-(int(now.Weekday())+6)%7, 0, 0, 0, 0, now.Location())
+	case "startOfMonth":
+		t = time.Date(y, mo, 1, 0, 0, 0, 0, now.Location())
+	case "startOfYear":
+		t = time.Date(y, time.January, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	for _, o := range offsetRegexp.FindAllStringSubmatch(m[2], -1) {
+		n, err := strconv.Atoi(o[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		if o[1] == "-" {
+			n = -n
+		}
+		switch o[3] {
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "h":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		}
+	}
+
+	return t, true
+}